@@ -21,28 +21,35 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/multichannel"
+	_ "github.com/Muges/go-tsm/ola"
+	_ "github.com/Muges/go-tsm/sola"
+	_ "github.com/Muges/go-tsm/solafs"
+	_ "github.com/Muges/go-tsm/speech"
 	"github.com/Muges/go-tsm/streamer"
 	"github.com/Muges/go-tsm/tsm"
-	"github.com/Muges/go-tsm/wsola"
+	_ "github.com/Muges/go-tsm/wsola"
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/speaker"
 	"github.com/faiface/beep/wav"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 )
 
 var (
 	app = kingpin.New("tsmplay", "Change the speed of a WAV audio file.")
 
-	speed          = app.Flag("speed", "Change the speed by N percents (100 by default).").Short('s').PlaceHolder("N").Default("-1").Float64()
-	method         = app.Flag("method", "Change the TSM method (ola or wsola).").Short('m').PlaceHolder("METHOD").Default("wsola").Enum("ola", "wsola")
+	speed          = app.Flag("speed", "Change the speed by the ratio N (1 by default, negative values play the file backwards).").Short('s').PlaceHolder("N").Default("1").Float64()
+	method         = app.Flag("method", "Change the TSM method ("+strings.Join(tsm.Methods(), ", ")+"), optionally followed by parameters (e.g. wsola:tolerance=256).").Short('m').PlaceHolder("METHOD").Default("wsola").String()
 	frameLength    = app.Flag("frame_length", "Set the frame length to N.").Short('l').PlaceHolder("N").Default("-1").Int()
 	synthesisHop   = app.Flag("synthesis_hop", "Set the synthesis hop to N.").PlaceHolder("N").Default("-1").Int()
 	tolerance      = app.Flag("tolerance", "Set the tolerance for the WSOLA procedure to N.").Short('t').PlaceHolder("N").Default("-1").Int()
+	preset         = app.Flag("preset", "Use the parameters of a preset (speech, music, percussive, extreme-stretch or low-latency), which are overridden by the other flags.").Short('p').PlaceHolder("PRESET").Enum("speech", "music", "percussive", "extreme-stretch", "low-latency")
 	outputFilename = app.Flag("output", "Save the stretched audio to FILENAME instead of playing it.").Short('o').PlaceHolder("FILENAME").String()
 
 	inputFilename = app.Arg("filename", "A wav file.").Required().ExistingFile()
@@ -70,44 +77,155 @@ func main() {
 	}
 
 	// Create TSM object
-	var t *tsm.TSM
-	switch *method {
-	case "ola":
-		t, err = ola.NewWithSpeed(2, *speed, *synthesisHop, *frameLength)
-	case "wsola":
-		t, err = wsola.NewWithSpeed(2, *speed, *synthesisHop, *frameLength, *tolerance)
-	default:
-		err = errors.New(fmt.Sprintf("Unknown TSM method \"%s\"", *method))
+	options := []tsm.Option{
+		tsm.WithSpeed(*speed),
+		tsm.WithSampleRate(int(format.SampleRate)),
 	}
+	if p, ok := tsm.Preset(*preset); ok {
+		options = append(options, p)
+	}
+	if *frameLength > 0 {
+		options = append(options, tsm.WithFrameLength(*frameLength))
+	}
+	if *synthesisHop > 0 {
+		options = append(options, tsm.WithSynthesisHop(*synthesisHop))
+	}
+	if *tolerance > 0 {
+		options = append(options, tsm.WithTolerance(*tolerance))
+	}
+
+	t, err := tsm.NewFromString(2, *method, options...)
 	if err != nil {
 		fmt.Println("error: unable to create the TSM object")
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	stretchedStream := streamer.New(t, stream)
 
 	if *outputFilename != "" {
-		outputFile, err := os.Create(*outputFilename)
-		if err != nil {
-			fmt.Printf("error: unable to open file \"%s\"\n", *outputFilename)
+		save(t, stream, format)
+		return
+	}
+
+	var stretchedStream beep.Streamer
+	if *speed < 0 {
+		// Playing the file backwards requires to keep all of it in the
+		// history of the TSM, and to start from its end.
+		samples := readAll(stream)
+		t.SetHistory(len(samples))
+		t.Seek(len(samples))
+		if _, err := t.Put(samples); err != nil {
+			fmt.Println("error: unable to process the file")
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		defer outputFile.Close()
 
-		wav.Encode(outputFile, stretchedStream, format)
+		outputLength := int(float64(len(samples)) / -*speed)
+		stretchedStream = beep.Take(outputLength, streamer.New(t, beep.Silence(-1)))
 	} else {
-		speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-		speaker.UnderrunCallback(func() { fmt.Println("underrun") })
+		stretchedStream = streamer.New(t, stream)
+	}
+
+	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
+	speaker.UnderrunCallback(func() { fmt.Println("underrun") })
+
+	// Create a channel that will be closed at the end of playback
+	done := make(chan struct{})
+
+	speaker.Play(beep.Seq(stretchedStream, beep.Callback(func() {
+		close(done)
+	})))
+
+	// Wait for the channel to be closed before quitting
+	<-done
+}
+
+// readAll reads all the samples of a stream.
+func readAll(stream beep.StreamSeekCloser) streamer.StereoBuffer {
+	samples := make(streamer.StereoBuffer, stream.Len())
+	length := 0
+	for length < len(samples) {
+		n, ok := stream.Stream(samples[length:])
+		length += n
+		if !ok {
+			break
+		}
+	}
+	return samples[:length]
+}
+
+// save stretches the whole stream with the TSM t, showing the progress of the
+// processing (which can be interrupted with Ctrl-C), and saves the result to
+// the output file.
+func save(t *tsm.TSM, stream beep.StreamSeekCloser, format beep.Format) {
+	samples := readAll(stream)
+	if *speed < 0 {
+		t.SetHistory(len(samples))
+		t.Seek(len(samples))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
 
-		// Create a channel that will be closed at the end of playback
-		done := make(chan struct{})
+	output, err := tsm.ProcessContext(ctx, t, samples, printProgress)
+	fmt.Fprintln(os.Stderr)
+	if err == context.Canceled {
+		fmt.Println("interrupted")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("error: unable to process the file")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	outputFile, err := os.Create(*outputFilename)
+	if err != nil {
+		fmt.Printf("error: unable to open file \"%s\"\n", *outputFilename)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer outputFile.Close()
+
+	if err := wav.Encode(outputFile, streamBuffer(output), format); err != nil {
+		fmt.Printf("error: unable to write file \"%s\"\n", *outputFilename)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
 
-		speaker.Play(beep.Seq(&stretchedStream, beep.Callback(func() {
-			close(done)
-		})))
+// progressBarWidth is the number of characters of the progress bar.
+const progressBarWidth = 40
 
-		// Wait for the channel to be closed before quitting
-		<-done
+// printProgress shows a progress bar on the standard error.
+func printProgress(processed int, total int) {
+	filled := progressBarWidth
+	percent := 100
+	if total > 0 {
+		filled = progressBarWidth * processed / total
+		percent = 100 * processed / total
 	}
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(" ", progressBarWidth-filled), percent)
+}
+
+// streamBuffer returns a Streamer streaming the samples of a stereo buffer.
+func streamBuffer(buffer multichannel.TSMBuffer) beep.Streamer {
+	position := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		if position >= buffer.Len() {
+			return 0, false
+		}
+		for n < len(samples) && position < buffer.Len() {
+			samples[n][0] = buffer[0][position]
+			samples[n][1] = buffer[1][position]
+			n++
+			position++
+		}
+		return n, true
+	})
 }
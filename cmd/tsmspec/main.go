@@ -0,0 +1,283 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Command tsmspec renders the spectrograms of a WAV audio file and of its
+// stretched version side by side in a PNG image, in order to show the artifacts
+// of the time-scale modification (such as transient smearing or doubling).
+package main
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	_ "github.com/Muges/go-tsm/ola"
+	_ "github.com/Muges/go-tsm/sola"
+	_ "github.com/Muges/go-tsm/solafs"
+	_ "github.com/Muges/go-tsm/speech"
+	"github.com/Muges/go-tsm/stft"
+	"github.com/Muges/go-tsm/streamer"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	_ "github.com/Muges/go-tsm/wsola"
+	"github.com/faiface/beep/wav"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+)
+
+var (
+	app = kingpin.New("tsmspec", "Render the spectrograms of a WAV audio file before and after changing its speed.")
+
+	speed        = app.Flag("speed", "Change the speed by N percents (100 by default, negative values play the file backwards).").Short('s').PlaceHolder("N").Default("100").Float64()
+	method       = app.Flag("method", "Change the TSM method ("+strings.Join(tsm.Methods(), ", ")+"), optionally followed by parameters (e.g. wsola:tolerance=256).").Short('m').PlaceHolder("METHOD").Default("wsola").String()
+	frameLength  = app.Flag("frame_length", "Set the frame length to N.").Short('l').PlaceHolder("N").Default("-1").Int()
+	synthesisHop = app.Flag("synthesis_hop", "Set the synthesis hop to N.").PlaceHolder("N").Default("-1").Int()
+	tolerance    = app.Flag("tolerance", "Set the tolerance for the WSOLA procedure to N.").Short('t').PlaceHolder("N").Default("-1").Int()
+	preset       = app.Flag("preset", "Use the parameters of a preset (speech, music, percussive, extreme-stretch or low-latency), which are overridden by the other flags.").Short('p').PlaceHolder("PRESET").Enum("speech", "music", "percussive", "extreme-stretch", "low-latency")
+
+	windowLength = app.Flag("window_length", "Set the length of the frames of the spectrograms to N.").PlaceHolder("N").Default("2048").Int()
+	hop          = app.Flag("hop", "Set the number of samples between two columns of the spectrograms to N.").PlaceHolder("N").Default("256").Int()
+	height       = app.Flag("height", "Set the height of the spectrograms to N pixels.").PlaceHolder("N").Default("512").Int()
+	maxFrequency = app.Flag("max_frequency", "Only show the frequencies below F Hz (all of them by default).").PlaceHolder("F").Default("0").Float64()
+	dynamicRange = app.Flag("range", "Set the dynamic range of the spectrograms to N dB.").PlaceHolder("N").Default("80").Float64()
+
+	inputFilename  = app.Arg("filename", "A wav file.").Required().ExistingFile()
+	outputFilename = app.Arg("output", "The PNG file to which the spectrograms are written.").Required().String()
+)
+
+// separatorWidth is the width in pixels of the line separating the
+// spectrograms.
+const separatorWidth = 4
+
+func main() {
+	// Read command-line arguments
+	app.HelpFlag.Short('h')
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	// Open and decode wav file
+	inputFile, err := os.Open(*inputFilename)
+	if err != nil {
+		fmt.Printf("error: unable to open file \"%s\"\n", *inputFilename)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer inputFile.Close()
+
+	stream, format, err := wav.Decode(inputFile)
+	if err != nil {
+		fmt.Printf("error: \"%s\" is not a valid wav file\n", *inputFilename)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	samples := make(streamer.StereoBuffer, stream.Len())
+	length := 0
+	for length < len(samples) {
+		n, ok := stream.Stream(samples[length:])
+		length += n
+		if !ok {
+			break
+		}
+	}
+	samples = samples[:length]
+
+	// Create TSM object
+	options := []tsm.Option{
+		tsm.WithSpeed(*speed / 100),
+		tsm.WithSampleRate(int(format.SampleRate)),
+	}
+	if p, ok := tsm.Preset(*preset); ok {
+		options = append(options, p)
+	}
+	if *frameLength > 0 {
+		options = append(options, tsm.WithFrameLength(*frameLength))
+	}
+	if *synthesisHop > 0 {
+		options = append(options, tsm.WithSynthesisHop(*synthesisHop))
+	}
+	if *tolerance > 0 {
+		options = append(options, tsm.WithTolerance(*tolerance))
+	}
+
+	t, err := tsm.NewFromString(2, *method, options...)
+	if err != nil {
+		fmt.Println("error: unable to create the TSM object")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *speed < 0 {
+		t.SetHistory(len(samples))
+		t.Seek(len(samples))
+	}
+
+	output, err := tsm.Process(t, samples)
+	if err != nil {
+		fmt.Println("error: unable to process the file")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Compute the spectrograms
+	settings := stft.NewSettings(2, *windowLength, *hop, window.Hanning)
+	before, err := spectrogram(settings, samples)
+	if err == nil {
+		var after [][]float64
+		after, err = spectrogram(settings, output)
+		if err == nil {
+			err = save(*outputFilename, render(before, after, binLimit(settings, int(format.SampleRate))))
+		}
+	}
+	if err != nil {
+		fmt.Println("error: unable to render the spectrograms")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// spectrogram returns the magnitudes (in dB) of the short-time Fourier
+// transform of the buffer, averaged over the channels.
+func spectrogram(settings stft.Settings, buffer multichannel.Buffer) ([][]float64, error) {
+	frames, err := stft.Analyze(settings, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([][]float64, len(frames))
+	for j, frame := range frames {
+		columns[j] = make([]float64, frame.Bins())
+		for i := range columns[j] {
+			var power float64
+			for k := 0; k < frame.Channels(); k++ {
+				m := frame.Magnitude(k, i)
+				power += m * m
+			}
+			columns[j][i] = 10 * math.Log10(power/float64(frame.Channels())+1e-20)
+		}
+	}
+
+	return columns, nil
+}
+
+// binLimit returns the number of bins below the maximum frequency.
+func binLimit(settings stft.Settings, sampleRate int) int {
+	size := settings.TransformSize()
+	bins := size/2 + 1
+	if *maxFrequency > 0 {
+		limit := int(math.Ceil(*maxFrequency*float64(size)/float64(sampleRate))) + 1
+		if limit < bins {
+			return limit
+		}
+	}
+	return bins
+}
+
+// render draws the spectrograms side by side, with the same color scale, only
+// showing their first bins.
+func render(before [][]float64, after [][]float64, bins int) image.Image {
+	width := len(before) + separatorWidth + len(after)
+	img := image.NewRGBA(image.Rect(0, 0, width, *height))
+
+	// The loudest bin of both spectrograms is at the top of the color scale
+	max := math.Inf(-1)
+	for _, columns := range [][][]float64{before, after} {
+		for _, column := range columns {
+			for _, v := range column[:bins] {
+				max = math.Max(max, v)
+			}
+		}
+	}
+
+	draw := func(columns [][]float64, x0 int) {
+		for x, column := range columns {
+			for y := 0; y < *height; y++ {
+				// Show the loudest of the bins covered by the pixel, the
+				// low frequencies being at the bottom
+				first := (*height - 1 - y) * bins / *height
+				last := (*height - y) * bins / *height
+				if last <= first {
+					last = first + 1
+				}
+				v := math.Inf(-1)
+				for _, b := range column[first:last] {
+					v = math.Max(v, b)
+				}
+
+				img.Set(x0+x, y, colormap(1+(v-max)/(*dynamicRange)))
+			}
+		}
+	}
+	draw(before, 0)
+	for x := len(before); x < len(before)+separatorWidth; x++ {
+		for y := 0; y < *height; y++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	draw(after, len(before)+separatorWidth)
+
+	return img
+}
+
+// colormapStops are the colors of the colormap, from silence to the loudest
+// bins.
+var colormapStops = []color.RGBA{
+	{0, 0, 4, 255},
+	{81, 18, 124, 255},
+	{183, 55, 121, 255},
+	{252, 137, 97, 255},
+	{252, 253, 191, 255},
+}
+
+// colormap returns the color corresponding to a value in [0, 1], which is
+// interpolated between the colormapStops.
+func colormap(v float64) color.RGBA {
+	if v <= 0 || math.IsNaN(v) {
+		return colormapStops[0]
+	}
+	if v >= 1 {
+		return colormapStops[len(colormapStops)-1]
+	}
+
+	position := v * float64(len(colormapStops)-1)
+	i := int(position)
+	ratio := position - float64(i)
+	c1, c2 := colormapStops[i], colormapStops[i+1]
+	interpolate := func(a uint8, b uint8) uint8 {
+		return uint8(float64(a) + ratio*(float64(b)-float64(a)) + 0.5)
+	}
+
+	return color.RGBA{interpolate(c1.R, c2.R), interpolate(c1.G, c2.G), interpolate(c1.B, c2.B), 255}
+}
+
+// save writes the image to a PNG file.
+func save(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package golden_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// tolerance is the maximal difference between a sample of an output and the
+// corresponding sample of the golden output. The samples are stored with 16
+// bits, which gives an error of at most 1.5e-5, so only the quantization
+// error is tolerated.
+const tolerance = 2e-5
+
+// The signals of the corpus (see testdata/generate).
+var corpus = []string{"sweep", "clicks", "chord", "speech"}
+
+// The methods for which golden outputs are stored, with the parameters that
+// were used to generate them, and the speeds at which they were computed (see
+// testdata/README.md).
+var methods = []struct {
+	name    string
+	process func(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error)
+	options []tsm.Option
+	speeds  []float64
+}{
+	{"ola", ola.Process, []tsm.Option{tsm.WithFrameLength(128), tsm.WithSynthesisHop(64)}, []float64{0.5, 1, 2}},
+	{"wsola", wsola.Process, []tsm.Option{tsm.WithFrameLength(512), tsm.WithSynthesisHop(256), tsm.WithTolerance(256)}, []float64{0.5, 2}},
+}
+
+// readWAV reads a mono signal from a 16-bit PCM WAV file written by
+// testdata/generate.
+func readWAV(filename string) ([]float64, error) {
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(file) < 44 || string(file[:4]) != "RIFF" || string(file[36:40]) != "data" {
+		return nil, errors.Errorf("%s is not a WAV file written by testdata/generate", filename)
+	}
+
+	data := file[44:]
+	signal := make([]float64, len(data)/2)
+	for i := range signal {
+		signal[i] = float64(int16(binary.LittleEndian.Uint16(data[2*i:]))) / 32767
+	}
+	return signal, nil
+}
+
+func TestGolden(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range corpus {
+		signal, err := readWAV(filepath.Join("testdata", "input", c+".wav"))
+		if !assert.NoError(err) {
+			continue
+		}
+		input := multichannel.TSMBuffer{signal}
+
+		for _, m := range methods {
+			for _, speed := range m.speeds {
+				name := fmt.Sprintf("%s %s (speed %g)", m.name, c, speed)
+				filename := filepath.Join("testdata", m.name, c+"_"+strconv.FormatFloat(speed, 'g', -1, 64)+".wav")
+
+				expected, err := readWAV(filename)
+				if !assert.NoError(err, name) {
+					continue
+				}
+
+				output, err := m.process(input, append([]tsm.Option{tsm.WithSpeed(speed)}, m.options...)...)
+				if !assert.NoError(err, name) || !assert.Equal(len(expected), output.Len(), name) {
+					continue
+				}
+				assert.InDeltaSlice(expected, output[0], tolerance, name)
+			}
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range corpus {
+		signal, err := readWAV(filepath.Join("testdata", "input", c+".wav"))
+		if !assert.NoError(err) {
+			continue
+		}
+		input := multichannel.TSMBuffer{signal}
+
+		// At a speed of 1, the methods should return their input
+		for _, m := range methods {
+			name := fmt.Sprintf("%s %s (speed 1)", m.name, c)
+			output, err := m.process(input, append([]tsm.Option{tsm.WithSpeed(1)}, m.options...)...)
+			if !assert.NoError(err, name) || !assert.Equal(input.Len(), output.Len(), name) {
+				continue
+			}
+			assert.InDeltaSlice(signal, output[0], 1e-9, name)
+		}
+	}
+}
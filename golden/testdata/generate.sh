@@ -0,0 +1,19 @@
+#!/bin/sh
+# Regenerates the corpus and the golden outputs of the golden tests with the
+# ola and wsola packages of the baseline commit, before the time-varying hops,
+# the flush padding, the FFT-based correlation and the other changes of the
+# TSM core that the golden tests are meant to check.
+set -e
+
+baseline=9a07de3
+testdata=$(cd "$(dirname "$0")" && pwd)
+worktree=$(mktemp -d)
+
+git -C "$testdata" worktree add --detach "$worktree" "$baseline"
+trap 'git -C "$testdata" worktree remove --force "$worktree"' EXIT
+
+cp -r "$testdata/generate" "$worktree/generate"
+cd "$worktree"
+go mod init github.com/Muges/go-tsm
+go get github.com/pkg/errors@v0.9.1
+go run ./generate "$testdata"
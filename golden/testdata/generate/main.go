@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Command generate writes the corpus and the golden outputs used by the golden
+// tests. It has to be built against the baseline implementation of the ola and
+// wsola packages, which is done by generate.sh.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/wsola"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// sampleRate is the sample rate of the signals of the corpus, and length their
+// number of samples.
+const (
+	sampleRate = 22050
+	length     = sampleRate / 4
+)
+
+// The signals of the corpus.
+var corpus = []struct {
+	name     string
+	generate func(i int) float64
+}{
+	{"sweep", sweep},
+	{"clicks", clicks},
+	{"chord", chord},
+	{"speech", speech},
+}
+
+// sweep is an exponential sine sweep from 100Hz to 8kHz.
+func sweep(i int) float64 {
+	t := float64(i) / sampleRate
+	duration := float64(length) / sampleRate
+	rate := math.Log(8000.0/100.0) / duration
+	return 0.5 * math.Sin(2*math.Pi*100*(math.Exp(rate*t)-1)/rate)
+}
+
+// clicks is a decaying 2kHz sine, repeated every 1000 samples.
+func clicks(i int) float64 {
+	t := float64(i%1000) / sampleRate
+	return 0.8 * math.Exp(-t/0.002) * math.Sin(2*math.Pi*2000*t)
+}
+
+// chord is a C major triad.
+func chord(i int) float64 {
+	t := float64(i) / sampleRate
+	return 0.2*math.Sin(2*math.Pi*261.63*t) + 0.2*math.Sin(2*math.Pi*329.63*t) + 0.2*math.Sin(2*math.Pi*392*t)
+}
+
+// speech is a speech-like signal: a train of glottal pulses with a varying
+// pitch, whose harmonics are shaped by two formants that change every 0.08s,
+// followed by a pause.
+func speech(i int) float64 {
+	t := float64(i) / sampleRate
+	if t > 0.2 {
+		return 0
+	}
+
+	vowels := [][2]float64{{700, 1220}, {300, 2300}, {570, 840}}
+	formants := vowels[int(t/0.08)%len(vowels)]
+	f0 := 140 + 40*math.Sin(2*math.Pi*4*t)
+
+	var v float64
+	for h := 1; float64(h)*f0 < sampleRate/2; h++ {
+		f := float64(h) * f0
+		var gain float64
+		for _, formant := range formants {
+			gain += 1 / (1 + math.Pow((f-formant)/80, 2))
+		}
+		v += gain / float64(h) * math.Sin(2*math.Pi*f*t)
+	}
+	return 0.2 * v
+}
+
+// The methods for which golden outputs are generated, with the parameters used
+// by the golden tests, and the speeds at which they are computed. The baseline
+// WSOLA does not return its input at a speed of 1, which the current one
+// does.
+var methods = []struct {
+	name        string
+	frameLength int
+	new         func(speed float64) (*tsm.TSM, error)
+	speeds      []float64
+}{
+	{"ola", 128, func(speed float64) (*tsm.TSM, error) {
+		return ola.NewWithSpeed(1, speed, 64, 128)
+	}, []float64{0.5, 1, 2}},
+	{"wsola", 512, func(speed float64) (*tsm.TSM, error) {
+		return wsola.NewWithSpeed(1, speed, 256, 512, 256)
+	}, []float64{0.5, 2}},
+}
+
+// process changes the speed of signal with t.
+//
+// The baseline TSM does not pad the end of the input when it is flushed, and
+// its Put method does not return the number of samples it read, so the
+// signal is padded with 2*frameLength zeros, the samples are put by blocks of
+// RemainingInputSpace, and the output is cut at the sample corresponding to
+// the end of the input.
+func process(t *tsm.TSM, signal []float64, speed float64, frameLength int) []float64 {
+	input := append(append([]float64{}, signal...), make([]float64, 2*frameLength)...)
+	var output []float64
+	chunk := multichannel.NewTSMBuffer(1, 1024)
+
+	for in := 0; in < len(input); {
+		n := t.RemainingInputSpace()
+		if n > len(input)-in {
+			n = len(input) - in
+		}
+		t.Put(multichannel.TSMBuffer{input[in : in+n]})
+		in += n
+
+		for {
+			n := t.Receive(chunk)
+			output = append(output, chunk[0][:n]...)
+			if n < chunk.Len() {
+				break
+			}
+		}
+	}
+
+	return output[:int(math.Floor(float64(len(signal))/speed+0.5))]
+}
+
+// sample converts v to a 16-bit sample.
+func sample(v float64) int16 {
+	v = math.Max(-1, math.Min(1, v))
+	return int16(math.Floor(v*32767 + 0.5))
+}
+
+// writeWAV writes a mono signal to a 16-bit PCM WAV file.
+func writeWAV(filename string, signal []float64) error {
+	var data bytes.Buffer
+	for _, v := range signal {
+		binary.Write(&data, binary.LittleEndian, sample(v))
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(36+data.Len()))
+	file.WriteString("WAVEfmt ")
+	binary.Write(&file, binary.LittleEndian, struct {
+		Size                      uint32
+		Format, Channels          uint16
+		SampleRate, ByteRate      uint32
+		BlockAlign, BitsPerSample uint16
+	}{16, 1, 1, sampleRate, 2 * sampleRate, 2, 16})
+	file.WriteString("data")
+	binary.Write(&file, binary.LittleEndian, uint32(data.Len()))
+	file.Write(data.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, file.Bytes(), 0644)
+}
+
+// generate writes the corpus and the golden outputs to the directory dir.
+func generate(dir string) error {
+	for _, c := range corpus {
+		// The signals are processed as they are read from the WAV files by
+		// the tests, with 16-bit samples.
+		signal := make([]float64, length)
+		for i := range signal {
+			signal[i] = float64(sample(c.generate(i))) / 32767
+		}
+		if err := writeWAV(filepath.Join(dir, "input", c.name+".wav"), signal); err != nil {
+			return err
+		}
+
+		for _, m := range methods {
+			for _, speed := range m.speeds {
+				t, err := m.new(speed)
+				if err != nil {
+					return err
+				}
+
+				output := process(t, signal, speed, m.frameLength)
+				filename := filepath.Join(dir, m.name, c.name+"_"+strconv.FormatFloat(speed, 'g', -1, 64)+".wav")
+				if err := writeWAV(filename, output); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: generate DIRECTORY")
+		os.Exit(2)
+	}
+	if err := generate(os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package correlation implements the normalized cross-correlations used by the
+// SOLA and SOLAFS time-scale modification procedures to align frames.
+package correlation
+
+import (
+	"math"
+)
+
+// cumulatedEnergy returns the cumulated energies of buffer, the i-th value
+// being the energy of buffer[:i].
+func cumulatedEnergy(buffer []float64) []float64 {
+	energy := make([]float64, len(buffer)+1)
+	for i, v := range buffer {
+		energy[i+1] = energy[i] + v*v
+	}
+	return energy
+}
+
+// Normalized returns, for each shift in [0, maxShift], the cross-correlation of
+// reference and buffer[shift:] on the samples where they overlap, normalized by
+// the energies of the two overlapping parts. The value is 0 if one of these
+// parts is silent.
+func Normalized(reference []float64, buffer []float64, maxShift int) []float64 {
+	referenceEnergy := cumulatedEnergy(reference)
+	bufferEnergy := cumulatedEnergy(buffer)
+
+	result := make([]float64, maxShift+1)
+	for shift := range result {
+		overlap := len(buffer) - shift
+		if overlap > len(reference) {
+			overlap = len(reference)
+		}
+		if overlap <= 0 {
+			break
+		}
+
+		var value float64
+		for i := 0; i < overlap; i++ {
+			value += reference[i] * buffer[shift+i]
+		}
+
+		energy := referenceEnergy[overlap] * (bufferEnergy[shift+overlap] - bufferEnergy[shift])
+		if energy > 0 {
+			result[shift] = value / math.Sqrt(energy)
+		}
+	}
+
+	return result
+}
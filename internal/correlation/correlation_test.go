@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package correlation
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+type normalizedTest struct {
+	reference []float64
+	buffer    []float64
+	maxShift  int
+	out       []float64
+}
+
+var normalizedTests = []normalizedTest{
+	{[]float64{1, 1, 1}, []float64{0, 0, 0}, 2, []float64{0, 0, 0}},
+	{[]float64{1, 2, 3}, []float64{1, 2, 3}, 0, []float64{1}},
+	{[]float64{1, -1, 0, 0}, []float64{0, 0, 1, -1}, 3, []float64{0, -0.5, 1, -1}},
+	{[]float64{2, 2}, []float64{1, 1, 1, 1}, 2, []float64{1, 1, 1}},
+	{[]float64{1, 2}, []float64{3, 1, 1}, 2, []float64{5 / math.Sqrt(50), 3 / math.Sqrt(10), 1}},
+}
+
+func TestNormalized(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range normalizedTests {
+		out := Normalized(c.reference, c.buffer, c.maxShift)
+		assert.InDeltaSlice(c.out, out, 0.000001, fmt.Sprintf("Normalized (%d)", i))
+	}
+}
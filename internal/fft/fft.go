@@ -0,0 +1,444 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package fft implements the fast Fourier transform used by the time-scale
+// modification and spectral analysis packages.
+//
+// The transforms of a given length are computed by a Plan (or a RealPlan for
+// real signals), which contains the factorization of the length and the
+// twiddle factors. Plans do not depend on the signal, and are cached by PlanFor
+// and RealPlanFor so that they are only computed once per length. They may be
+// used concurrently.
+package fft
+
+import (
+	"math"
+	"sync"
+)
+
+// A Plan computes the discrete Fourier transforms of complex signals of a
+// given length, with a mixed-radix Cooley-Tukey algorithm. The transforms are
+// the fastest when the length only has small prime factors (see
+// NextFastSize).
+type Plan struct {
+	n       int
+	factors []int
+
+	// twRe[j] and twIm[j] are the real and imaginary parts of
+	// exp(-2i*pi*j/n).
+	twRe []float64
+	twIm []float64
+
+	scratch sync.Pool
+}
+
+// scratch contains the buffers used by the transforms.
+type scratch struct {
+	re  []float64
+	im  []float64
+	tRe []float64
+	tIm []float64
+}
+
+// NewPlan returns a Plan for signals of length n, which should be strictly
+// positive.
+func NewPlan(n int) *Plan {
+	p := &Plan{
+		n:       n,
+		factors: factorize(n),
+		twRe:    make([]float64, n),
+		twIm:    make([]float64, n),
+	}
+
+	for j := range p.twRe {
+		angle := -2 * math.Pi * float64(j) / float64(n)
+		p.twRe[j], p.twIm[j] = math.Cos(angle), math.Sin(angle)
+	}
+
+	maxFactor := 1
+	for _, f := range p.factors {
+		if f > maxFactor {
+			maxFactor = f
+		}
+	}
+	p.scratch.New = func() interface{} {
+		return &scratch{
+			re:  make([]float64, n),
+			im:  make([]float64, n),
+			tRe: make([]float64, maxFactor),
+			tIm: make([]float64, maxFactor),
+		}
+	}
+
+	return p
+}
+
+// factorize returns the factors used to compute a transform of length n: as
+// many 4 as possible, then 2, and the other prime factors in increasing order.
+func factorize(n int) []int {
+	var factors []int
+	for n%4 == 0 {
+		factors = append(factors, 4)
+		n /= 4
+	}
+	for f := 2; n > 1; f++ {
+		for n%f == 0 {
+			factors = append(factors, f)
+			n /= f
+		}
+		if f*f > n && n > 1 {
+			factors = append(factors, n)
+			break
+		}
+	}
+	return factors
+}
+
+// plans contains the plans returned by PlanFor and RealPlanFor.
+var (
+	plansMu   sync.Mutex
+	plans     = make(map[int]*Plan)
+	realPlans = make(map[int]*RealPlan)
+)
+
+// PlanFor returns a Plan for signals of length n, which is computed the first
+// time and then cached.
+func PlanFor(n int) *Plan {
+	plansMu.Lock()
+	defer plansMu.Unlock()
+
+	p, ok := plans[n]
+	if !ok {
+		p = NewPlan(n)
+		plans[n] = p
+	}
+	return p
+}
+
+// NextFastSize returns the smallest length larger than or equal to n whose
+// only prime factors are 2, 3 and 5, for which the transforms are the
+// fastest.
+func NextFastSize(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	for m := n; ; m++ {
+		r := m
+		for _, f := range []int{2, 3, 5} {
+			for r%f == 0 {
+				r /= f
+			}
+		}
+		if r == 1 {
+			return m
+		}
+	}
+}
+
+// Len returns the length of the signals transformed by the Plan.
+func (p *Plan) Len() int {
+	return p.n
+}
+
+// Forward computes in place the discrete Fourier transform of the complex
+// signal whose real and imaginary parts are re and im. They should both have
+// the length of the Plan.
+func (p *Plan) Forward(re []float64, im []float64) {
+	s := p.scratch.Get().(*scratch)
+	copy(s.re, re[:p.n])
+	copy(s.im, im[:p.n])
+	p.transform(s.re, s.im, 0, 1, re, im, 0, p.n, 0, s)
+	p.scratch.Put(s)
+}
+
+// Inverse computes in place the inverse discrete Fourier transform of the
+// complex signal whose real and imaginary parts are re and im, including the
+// normalization by the length. They should both have the length of the Plan.
+func (p *Plan) Inverse(re []float64, im []float64) {
+	// The inverse transform is the conjugate of the transform of the
+	// conjugate.
+	for i := range im[:p.n] {
+		im[i] = -im[i]
+	}
+	p.Forward(re, im)
+
+	scale := 1 / float64(p.n)
+	for i := range re[:p.n] {
+		re[i] *= scale
+		im[i] *= -scale
+	}
+}
+
+// transform computes the transform of length n of the signal in[offset],
+// in[offset+stride], ..., and writes it to out[outOffset:outOffset+n],
+// using the factors from factors[level].
+func (p *Plan) transform(inRe, inIm []float64, offset int, stride int, outRe, outIm []float64, outOffset int, n int, level int, s *scratch) {
+	if n == 1 {
+		outRe[outOffset] = inRe[offset]
+		outIm[outOffset] = inIm[offset]
+		return
+	}
+
+	r := p.factors[level]
+	m := n / r
+
+	// Transform the r subsequences of length m, whose transforms are stored
+	// one after the other
+	for q := 0; q < r; q++ {
+		p.transform(inRe, inIm, offset+q*stride, stride*r, outRe, outIm, outOffset+q*m, m, level+1, s)
+	}
+
+	// Combine them with butterflies, where exp(-2i*pi*j/n) is the twiddle
+	// factor j*step
+	step := p.n / n
+	re, im := outRe[outOffset:outOffset+n], outIm[outOffset:outOffset+n]
+	switch r {
+	case 2:
+		for k := 0; k < m; k++ {
+			wRe, wIm := p.twRe[k*step], p.twIm[k*step]
+			bRe := re[k+m]*wRe - im[k+m]*wIm
+			bIm := re[k+m]*wIm + im[k+m]*wRe
+
+			re[k+m], im[k+m] = re[k]-bRe, im[k]-bIm
+			re[k], im[k] = re[k]+bRe, im[k]+bIm
+		}
+	case 4:
+		for k := 0; k < m; k++ {
+			x0Re, x0Im := re[k], im[k]
+			x1Re, x1Im := p.twiddle(re[k+m], im[k+m], k*step)
+			x2Re, x2Im := p.twiddle(re[k+2*m], im[k+2*m], 2*k*step)
+			x3Re, x3Im := p.twiddle(re[k+3*m], im[k+3*m], 3*k*step)
+
+			y0Re, y0Im := x0Re+x2Re, x0Im+x2Im
+			y1Re, y1Im := x0Re-x2Re, x0Im-x2Im
+			y2Re, y2Im := x1Re+x3Re, x1Im+x3Im
+			y3Re, y3Im := x1Re-x3Re, x1Im-x3Im
+
+			re[k], im[k] = y0Re+y2Re, y0Im+y2Im
+			re[k+m], im[k+m] = y1Re+y3Im, y1Im-y3Re
+			re[k+2*m], im[k+2*m] = y0Re-y2Re, y0Im-y2Im
+			re[k+3*m], im[k+3*m] = y1Re-y3Im, y1Im+y3Re
+		}
+	default:
+		tRe, tIm := s.tRe[:r], s.tIm[:r]
+		for k := 0; k < m; k++ {
+			for q := range tRe {
+				tRe[q], tIm[q] = p.twiddle(re[k+q*m], im[k+q*m], q*k*step)
+			}
+
+			// Naive transform of length r
+			for u := 0; u < r; u++ {
+				var sumRe, sumIm float64
+				for q := range tRe {
+					j := (q * u % r) * (p.n / r)
+					sumRe += tRe[q]*p.twRe[j] - tIm[q]*p.twIm[j]
+					sumIm += tRe[q]*p.twIm[j] + tIm[q]*p.twRe[j]
+				}
+				re[k+u*m], im[k+u*m] = sumRe, sumIm
+			}
+		}
+	}
+}
+
+// twiddle returns the product of a complex number and the twiddle factor j.
+func (p *Plan) twiddle(re float64, im float64, j int) (float64, float64) {
+	return re*p.twRe[j] - im*p.twIm[j], re*p.twIm[j] + im*p.twRe[j]
+}
+
+// A RealPlan computes the discrete Fourier transforms of real signals of a
+// given length. Since the spectrum of a real signal of length n is symmetric,
+// only its first n/2+1 bins are computed.
+type RealPlan struct {
+	n int
+
+	// For an even length, the transform is computed from the one of a
+	// complex signal of half the length, whose real and imaginary parts are
+	// the even and odd samples of the signal. Otherwise, it is computed
+	// with a complex transform of the same length.
+	half    *Plan
+	complex *Plan
+	twRe    []float64
+	twIm    []float64
+
+	scratch sync.Pool
+}
+
+// NewRealPlan returns a RealPlan for signals of length n, which should be
+// strictly positive.
+func NewRealPlan(n int) *RealPlan {
+	p := &RealPlan{n: n}
+
+	if n%2 == 0 {
+		p.half = PlanFor(n / 2)
+		p.twRe = make([]float64, n/2)
+		p.twIm = make([]float64, n/2)
+		for k := range p.twRe {
+			angle := -2 * math.Pi * float64(k) / float64(n)
+			p.twRe[k], p.twIm[k] = math.Cos(angle), math.Sin(angle)
+		}
+	} else {
+		p.complex = PlanFor(n)
+	}
+	p.scratch.New = func() interface{} {
+		return &scratch{
+			re: make([]float64, n),
+			im: make([]float64, n),
+		}
+	}
+
+	return p
+}
+
+// RealPlanFor returns a RealPlan for signals of length n, which is computed
+// the first time and then cached.
+func RealPlanFor(n int) *RealPlan {
+	plansMu.Lock()
+	p, ok := realPlans[n]
+	plansMu.Unlock()
+	if ok {
+		return p
+	}
+
+	// NewRealPlan calls PlanFor, which locks plansMu
+	p = NewRealPlan(n)
+
+	plansMu.Lock()
+	defer plansMu.Unlock()
+	if cached, ok := realPlans[n]; ok {
+		return cached
+	}
+	realPlans[n] = p
+	return p
+}
+
+// Len returns the length of the signals transformed by the RealPlan.
+func (p *RealPlan) Len() int {
+	return p.n
+}
+
+// Bins returns the number of bins of the spectra computed by the RealPlan
+// (Len()/2+1).
+func (p *RealPlan) Bins() int {
+	return p.n/2 + 1
+}
+
+// Forward computes the first Bins() bins of the discrete Fourier transform of
+// the real signal, and writes their real and imaginary parts to re and im.
+func (p *RealPlan) Forward(signal []float64, re []float64, im []float64) {
+	if p.complex != nil {
+		s := p.scratch.Get().(*scratch)
+		copy(s.re, signal[:p.n])
+		for i := range s.im {
+			s.im[i] = 0
+		}
+		p.complex.Forward(s.re, s.im)
+		copy(re, s.re[:p.Bins()])
+		copy(im, s.im[:p.Bins()])
+		p.scratch.Put(s)
+		return
+	}
+
+	h := p.n / 2
+	for j := 0; j < h; j++ {
+		re[j], im[j] = signal[2*j], signal[2*j+1]
+	}
+	p.half.Forward(re[:h], im[:h])
+
+	// If Z is the transform of the complex signal, the transforms of the
+	// even and odd samples are E[k] = (Z[k] + conj(Z[h-k]))/2 and O[k] =
+	// (Z[k] - conj(Z[h-k]))/2i, and the transform of the signal is X[k] =
+	// E[k] + exp(-2i*pi*k/n)*O[k].
+	z0Re, z0Im := re[0], im[0]
+	re[0], im[0] = z0Re+z0Im, 0
+	re[h], im[h] = z0Re-z0Im, 0
+	for k := 1; k <= h/2; k++ {
+		zkRe, zkIm := re[k], im[k]
+		zcRe, zcIm := re[h-k], -im[h-k]
+
+		eRe, eIm := (zkRe+zcRe)/2, (zkIm+zcIm)/2
+		oRe, oIm := (zkIm-zcIm)/2, -(zkRe-zcRe)/2
+		wRe, wIm := p.twRe[k], p.twIm[k]
+		woRe, woIm := wRe*oRe-wIm*oIm, wRe*oIm+wIm*oRe
+
+		// X[h-k] = conj(E[k]) - conj(exp(-2i*pi*k/n)*O[k])
+		re[k], im[k] = eRe+woRe, eIm+woIm
+		re[h-k], im[h-k] = eRe-woRe, -eIm+woIm
+	}
+}
+
+// Inverse computes the real signal whose discrete Fourier transform has the
+// first Bins() bins given by re and im, and writes it to signal. The imaginary
+// parts of the bins 0 and n/2 are ignored, since they are always 0 for a real
+// signal.
+func (p *RealPlan) Inverse(re []float64, im []float64, signal []float64) {
+	s := p.scratch.Get().(*scratch)
+	defer p.scratch.Put(s)
+
+	if p.complex != nil {
+		n := p.n
+		copy(s.re, re[:p.Bins()])
+		copy(s.im, im[:p.Bins()])
+		s.im[0] = 0
+		for i := 1; i < p.Bins(); i++ {
+			s.re[n-i] = s.re[i]
+			s.im[n-i] = -s.im[i]
+		}
+		p.complex.Inverse(s.re, s.im)
+		copy(signal, s.re)
+		return
+	}
+
+	// Recover the transform Z of the complex signal whose real and imaginary
+	// parts are the even and odd samples, from E[k] = (X[k] +
+	// conj(X[h-k]))/2 and O[k] = (X[k] - conj(X[h-k]))/2*exp(2i*pi*k/n).
+	h := p.n / 2
+	zRe, zIm := s.re[:h], s.im[:h]
+	for k := 0; k < h; k++ {
+		xkRe, xkIm := re[k], im[k]
+		xcRe, xcIm := re[h-k], -im[h-k]
+		if k == 0 {
+			xkIm, xcIm = 0, 0
+		}
+
+		eRe, eIm := (xkRe+xcRe)/2, (xkIm+xcIm)/2
+		dRe, dIm := (xkRe-xcRe)/2, (xkIm-xcIm)/2
+		wRe, wIm := p.twRe[k], -p.twIm[k]
+		oRe, oIm := dRe*wRe-dIm*wIm, dRe*wIm+dIm*wRe
+
+		zRe[k], zIm[k] = eRe-oIm, eIm+oRe
+	}
+	p.half.Inverse(zRe, zIm)
+
+	for j := 0; j < h; j++ {
+		signal[2*j], signal[2*j+1] = zRe[j], zIm[j]
+	}
+}
+
+// Transform computes in place the discrete Fourier transform of the complex
+// signal whose real and imaginary parts are re and im, or its inverse if
+// inverse is true, with the cached Plan for their length.
+func Transform(re []float64, im []float64, inverse bool) {
+	p := PlanFor(len(re))
+	if inverse {
+		p.Inverse(re, im)
+	} else {
+		p.Forward(re, im)
+	}
+}
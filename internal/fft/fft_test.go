@@ -0,0 +1,171 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package fft_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/internal/fft"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// dft computes the discrete Fourier transform of a complex signal with the
+// naive O(n²) algorithm.
+func dft(re []float64, im []float64) ([]float64, []float64) {
+	n := len(re)
+	outRe, outIm := make([]float64, n), make([]float64, n)
+	for k := 0; k < n; k++ {
+		for j := 0; j < n; j++ {
+			angle := -2 * math.Pi * float64(j*k%n) / float64(n)
+			c, s := math.Cos(angle), math.Sin(angle)
+			outRe[k] += re[j]*c - im[j]*s
+			outIm[k] += re[j]*s + im[j]*c
+		}
+	}
+	return outRe, outIm
+}
+
+// random returns a random signal of length n.
+func random(r *rand.Rand, n int) []float64 {
+	signal := make([]float64, n)
+	for i := range signal {
+		signal[i] = 2*r.Float64() - 1
+	}
+	return signal
+}
+
+// lengths contains powers of two, lengths with small prime factors, and
+// lengths with large ones.
+var lengths = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 15, 16, 30, 64, 97, 100, 128, 210, 243, 256, 500, 1000, 1024, 1031}
+
+func TestPlan(t *testing.T) {
+	assert := assert.New(t)
+	r := rand.New(rand.NewSource(0))
+
+	for _, n := range lengths {
+		re, im := random(r, n), random(r, n)
+		expectedRe, expectedIm := dft(re, im)
+
+		p := fft.PlanFor(n)
+		assert.Equal(n, p.Len())
+
+		outRe, outIm := append([]float64(nil), re...), append([]float64(nil), im...)
+		p.Forward(outRe, outIm)
+		assert.InDeltaSlice(expectedRe, outRe, 1e-9, fmt.Sprintf("Forward (%d)", n))
+		assert.InDeltaSlice(expectedIm, outIm, 1e-9, fmt.Sprintf("Forward (%d)", n))
+
+		p.Inverse(outRe, outIm)
+		assert.InDeltaSlice(re, outRe, 1e-12, fmt.Sprintf("Inverse (%d)", n))
+		assert.InDeltaSlice(im, outIm, 1e-12, fmt.Sprintf("Inverse (%d)", n))
+	}
+}
+
+func TestRealPlan(t *testing.T) {
+	assert := assert.New(t)
+	r := rand.New(rand.NewSource(0))
+
+	for _, n := range lengths {
+		signal := random(r, n)
+		expectedRe, expectedIm := dft(signal, make([]float64, n))
+
+		p := fft.RealPlanFor(n)
+		assert.Equal(n, p.Len())
+		assert.Equal(n/2+1, p.Bins())
+
+		re, im := make([]float64, p.Bins()), make([]float64, p.Bins())
+		p.Forward(signal, re, im)
+		assert.InDeltaSlice(expectedRe[:p.Bins()], re, 1e-9, fmt.Sprintf("Forward (%d)", n))
+		assert.InDeltaSlice(expectedIm[:p.Bins()], im, 1e-9, fmt.Sprintf("Forward (%d)", n))
+
+		output := make([]float64, n)
+		p.Inverse(re, im, output)
+		assert.InDeltaSlice(signal, output, 1e-12, fmt.Sprintf("Inverse (%d)", n))
+	}
+}
+
+func TestTransform(t *testing.T) {
+	assert := assert.New(t)
+
+	re := []float64{1, 2, 3, 4}
+	im := []float64{0, 0, 0, 0}
+	fft.Transform(re, im, false)
+	assert.InDeltaSlice([]float64{10, -2, -2, -2}, re, 1e-12)
+	assert.InDeltaSlice([]float64{0, 2, 0, -2}, im, 1e-12)
+
+	fft.Transform(re, im, true)
+	assert.InDeltaSlice([]float64{1, 2, 3, 4}, re, 1e-12)
+	assert.InDeltaSlice([]float64{0, 0, 0, 0}, im, 1e-12)
+}
+
+func TestNextFastSize(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range []struct {
+		in  int
+		out int
+	}{
+		{0, 1}, {1, 1}, {2, 2}, {7, 8}, {11, 12}, {97, 100}, {1000, 1000}, {1025, 1080},
+	} {
+		assert.Equal(c.out, fft.NextFastSize(c.in), fmt.Sprintf("NextFastSize(%d)", c.in))
+	}
+}
+
+func benchmarkPlan(b *testing.B, n int) {
+	p := fft.PlanFor(n)
+	r := rand.New(rand.NewSource(0))
+	re, im := random(r, n), random(r, n)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Forward(re, im)
+	}
+}
+
+func benchmarkRealPlan(b *testing.B, n int) {
+	p := fft.RealPlanFor(n)
+	r := rand.New(rand.NewSource(0))
+	signal := random(r, n)
+	re, im := make([]float64, p.Bins()), make([]float64, p.Bins())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Forward(signal, re, im)
+	}
+}
+
+func BenchmarkPlan1024(b *testing.B)     { benchmarkPlan(b, 1024) }
+func BenchmarkPlan1000(b *testing.B)     { benchmarkPlan(b, 1000) }
+func BenchmarkPlan4096(b *testing.B)     { benchmarkPlan(b, 4096) }
+func BenchmarkRealPlan1024(b *testing.B) { benchmarkRealPlan(b, 1024) }
+func BenchmarkRealPlan1000(b *testing.B) { benchmarkRealPlan(b, 1000) }
+func BenchmarkRealPlan4096(b *testing.B) { benchmarkRealPlan(b, 4096) }
+
+func BenchmarkDFT1024(b *testing.B) {
+	r := rand.New(rand.NewSource(0))
+	re, im := random(r, 1024), random(r, 1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dft(re, im)
+	}
+}
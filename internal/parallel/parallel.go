@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package parallel distributes the processing of the channels of a frame
+// between goroutines for the time-scale modification packages.
+package parallel
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// MinWork is the minimal amount of work (as estimated by the caller of
+// ForEachChannel, usually in multiply-adds) that has to be done on all the
+// channels of a frame for ForEachChannel to process them concurrently. Below
+// it, starting the goroutines costs more than it saves.
+var MinWork = 1 << 16
+
+// ForEachChannel calls f(k) for each channel k in [0, channels). work is an
+// estimation of the amount of work done by each call to f.
+//
+// The channels are processed concurrently, by at most runtime.GOMAXPROCS(0)
+// goroutines, when there are several channels and the total amount of work
+// is at least MinWork. f should therefore only modify data belonging
+// to channel k. ForEachChannel returns once all the calls to f have returned.
+func ForEachChannel(channels int, work int, f func(k int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > channels {
+		workers = channels
+	}
+
+	if workers <= 1 || channels*work < MinWork {
+		for k := 0; k < channels; k++ {
+			f(k)
+		}
+		return
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				k := int(atomic.AddInt64(&next, 1))
+				if k >= channels {
+					return
+				}
+				f(k)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package parallel
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEachChannel(t *testing.T) {
+	assert := assert.New(t)
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	for _, channels := range []int{0, 1, 2, 16} {
+		for _, work := range []int{0, MinWork} {
+			counts := make([]int32, channels)
+			ForEachChannel(channels, work, func(k int) {
+				atomic.AddInt32(&counts[k], 1)
+			})
+			for k := range counts {
+				assert.Equal(int32(1), counts[k], fmt.Sprintf("ForEachChannel(%d, %d) channel %d", channels, work, k))
+			}
+		}
+	}
+}
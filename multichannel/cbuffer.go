@@ -20,6 +20,11 @@
 
 package multichannel
 
+// NormalizeThreshold is the threshold under which the values of a
+// NormalizeBuffer are ignored by CBuffer.Divide, to avoid divisions by zero
+// (or by values close to zero).
+const NormalizeThreshold = 0.0001
+
 // A CBuffer is a fixed-size circular buffer used to store multi-channel audio
 // data.
 //
@@ -56,7 +61,8 @@ func NewCBuffer(channels int, size int) CBuffer {
 // readable and to prevent them from being modified.
 //
 // Add will panic if the two buffer do not have the same number of channels or
-// if there is not enough space in the writable part of the CBuffer.
+// if there is not enough space in the writable part of the CBuffer (see
+// CheckedAdd).
 //
 //    c := multichannel.NewCBuffer(1, 4)
 //    c.Add(multichannel.Buffer{{1, 2}}
@@ -72,21 +78,33 @@ func NewCBuffer(channels int, size int) CBuffer {
 //    fmt.Println(buffer) // prints [[1, 2, 0]]
 //
 func (c *CBuffer) Add(buffer TSMBuffer) {
+	if err := c.CheckedAdd(buffer); err != nil {
+		panic(err)
+	}
+}
+
+// CheckedAdd is equivalent to Add, but returns ErrChannelMismatch or
+// ErrNotEnoughSpace instead of panicking, in which case the CBuffer is left
+// unchanged.
+func (c *CBuffer) CheckedAdd(buffer TSMBuffer) error {
 	if len(c.data) != len(buffer) {
-		panic("the two buffers should have the same number of channels")
+		return ErrChannelMismatch
 	}
 
 	remainingSpace := c.RemainingSpace()
-
-	for k := range c.data {
+	for k := range buffer {
 		if len(buffer[k]) > remainingSpace {
-			panic("not enough space remaining in the circular buffer")
+			return ErrNotEnoughSpace
 		}
+	}
 
+	for k := range c.data {
 		for i := range buffer[k] {
 			c.data[k][(c.readPointer+c.length+i)%c.size] += buffer[k][i]
 		}
 	}
+
+	return nil
 }
 
 // Divide divides each channel of the CBuffer by the first n values of the
@@ -97,26 +115,38 @@ func (c *CBuffer) Add(buffer TSMBuffer) {
 // methods. SetReadable should be called to mark these samples as readable and
 // to prevent them from being modified.
 //
-// The values of the NormalizeBuffer that are lower than 0.0001 are ignored to
-// avoid division by zero.
+// The values of the NormalizeBuffer whose absolute values are lower than
+// NormalizeThreshold are ignored to avoid division by zero.
 //
 // Divide will panic if there is not enough space in the writable part of the
-// CBuffer.
+// CBuffer (see CheckedDivide).
 func (c *CBuffer) Divide(buffer NormalizeBuffer, n int) {
-	const epsilon = 0.0001
+	if err := c.CheckedDivide(buffer, n); err != nil {
+		panic(err)
+	}
+}
 
+// CheckedDivide is equivalent to Divide, but returns ErrNotEnoughSpace or
+// ErrOutOfRange instead of panicking, in which case the CBuffer is left
+// unchanged.
+func (c *CBuffer) CheckedDivide(buffer NormalizeBuffer, n int) error {
 	if n > c.RemainingSpace() {
-		panic("not enough space remaining in the circular buffer")
+		return ErrNotEnoughSpace
+	}
+	if n > len(buffer.data) {
+		return ErrOutOfRange
 	}
 
 	for i := 0; i < n; i++ {
 		v := buffer.Get(i)
-		if v < -epsilon || v > epsilon {
+		if v < -NormalizeThreshold || v > NormalizeThreshold {
 			for k := range c.data {
 				c.data[k][(c.readPointer+c.length+i)%c.size] /= v
 			}
 		}
 	}
+
+	return nil
 }
 
 // Len returns the number of samples that each channel contains (i.e. the size
@@ -129,10 +159,21 @@ func (c *CBuffer) Len() int {
 // buffer.Len())) without removing them from the CBuffer, writes them to the
 // buffer, and returns the number of samples that were read.
 //
-// It panics if the two buffer do not have the same number of channels.
+// It panics if the two buffer do not have the same number of channels (see
+// CheckedPeek).
 func (c *CBuffer) Peek(samples Buffer) int {
+	n, err := c.CheckedPeek(samples)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// CheckedPeek is equivalent to Peek, but returns ErrChannelMismatch instead of
+// panicking.
+func (c *CBuffer) CheckedPeek(samples Buffer) (int, error) {
 	if len(c.data) != samples.Channels() {
-		panic("the two buffers should have the same number of channels")
+		return 0, ErrChannelMismatch
 	}
 
 	n := samples.Len()
@@ -152,20 +193,76 @@ func (c *CBuffer) Peek(samples Buffer) int {
 		//}
 	}
 
+	return n, nil
+}
+
+// PeekAt reads samples.Len() samples from the CBuffer, starting at the offset-th
+// readable sample, without removing them from the CBuffer, writes them to the
+// buffer, and returns the number of samples that were actually read from the
+// CBuffer.
+//
+// offset may be negative, and offset+samples.Len() may be larger than c.Len():
+// the samples of the buffer that are outside of the readable part of the
+// CBuffer are set to zero.
+//
+// It panics if the two buffer do not have the same number of channels (see
+// CheckedPeekAt).
+func (c *CBuffer) PeekAt(samples Buffer, offset int) int {
+	n, err := c.CheckedPeekAt(samples, offset)
+	if err != nil {
+		panic(err)
+	}
 	return n
 }
 
+// CheckedPeekAt is equivalent to PeekAt, but returns ErrChannelMismatch instead
+// of panicking.
+func (c *CBuffer) CheckedPeekAt(samples Buffer, offset int) (int, error) {
+	if len(c.data) != samples.Channels() {
+		return 0, ErrChannelMismatch
+	}
+
+	n := 0
+	for i := 0; i < samples.Len(); i++ {
+		j := offset + i
+		if j < 0 || j >= c.length {
+			for k := range c.data {
+				samples.SetSample(k, i, 0)
+			}
+		} else {
+			for k := range c.data {
+				samples.SetSample(k, i, c.data[k][(c.readPointer+j)%c.size])
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
+
 // Read reads as many samples from the CBuffer as possible (min(c.Len(),
 // buffer.Len()), removes them from the CBuffer, writes them to the buffer, and
 // returns the number of samples that were read.
 //
-// It panics if the two buffer do not have the same number of channels.
+// It panics if the two buffer do not have the same number of channels (see
+// CheckedRead).
 func (c *CBuffer) Read(buffer Buffer) int {
 	n := c.Peek(buffer)
 	c.Remove(n)
 	return n
 }
 
+// CheckedRead is equivalent to Read, but returns ErrChannelMismatch instead of
+// panicking.
+func (c *CBuffer) CheckedRead(buffer Buffer) (int, error) {
+	n, err := c.CheckedPeek(buffer)
+	if err != nil {
+		return 0, err
+	}
+	c.Remove(n)
+	return n, nil
+}
+
 // RemainingSpace returns the number of samples that can be added to each
 // channel (i.e. the size of the writable part).
 func (c *CBuffer) RemainingSpace() int {
@@ -192,22 +289,42 @@ func (c *CBuffer) Remove(n int) {
 
 // SetReadable sets the next n samples as readable.
 //
-// It panics if there is not enough space in the CBuffer.
+// It panics if there is not enough space in the CBuffer (see
+// CheckedSetReadable).
 func (c *CBuffer) SetReadable(n int) {
+	if err := c.CheckedSetReadable(n); err != nil {
+		panic(err)
+	}
+}
+
+// CheckedSetReadable is equivalent to SetReadable, but returns
+// ErrNotEnoughSpace instead of panicking.
+func (c *CBuffer) CheckedSetReadable(n int) error {
 	if c.RemainingSpace() < n {
-		panic("not enough space remaining in the circular buffer")
+		return ErrNotEnoughSpace
 	}
 	c.length += n
+	return nil
 }
 
 // Write writes as many samples as possible from the buffer to the CBuffer, and
 // returns the number of samples that were written.
 //
 // It panics if the CBuffer and the buffer do not have the same number of
-// channels.
+// channels (see CheckedWrite).
 func (c *CBuffer) Write(buffer Buffer) int {
+	n, err := c.CheckedWrite(buffer)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// CheckedWrite is equivalent to Write, but returns ErrChannelMismatch instead
+// of panicking.
+func (c *CBuffer) CheckedWrite(buffer Buffer) (int, error) {
 	if len(c.data) != buffer.Channels() {
-		panic("the two buffers should have the same number of channels")
+		return 0, ErrChannelMismatch
 	}
 
 	n := buffer.Len()
@@ -228,5 +345,5 @@ func (c *CBuffer) Write(buffer Buffer) int {
 	}
 	c.length += n
 
-	return n
+	return n, nil
 }
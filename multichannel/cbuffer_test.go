@@ -121,3 +121,62 @@ func TestWrite(t *testing.T) {
 	n = buffer.Write(multichannel.TSMBuffer{{1, 2}, {3, 4}})
 	assert.Equal(1, n, "Incomplete Write")
 }
+
+func TestPeekAt(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := multichannel.NewCBuffer(2, 5)
+	buffer.Write(multichannel.TSMBuffer{{1, 2, 3, 4}, {5, 6, 7, 8}})
+	buffer.Remove(1)
+	buffer.Write(multichannel.TSMBuffer{{5, 6}, {9, 10}})
+
+	samples := multichannel.NewTSMBuffer(2, 3)
+	n := buffer.PeekAt(samples, 2)
+	assert.Equal(3, n, "Size of PeekAt inside the CBuffer")
+	assert.Equal(multichannel.TSMBuffer{{4, 5, 6}, {8, 9, 10}}, samples, "PeekAt inside the CBuffer")
+
+	n = buffer.PeekAt(samples, -2)
+	assert.Equal(1, n, "Size of PeekAt before the CBuffer")
+	assert.Equal(multichannel.TSMBuffer{{0, 0, 2}, {0, 0, 6}}, samples, "PeekAt before the CBuffer")
+
+	n = buffer.PeekAt(samples, 4)
+	assert.Equal(1, n, "Size of PeekAt after the CBuffer")
+	assert.Equal(multichannel.TSMBuffer{{6, 0, 0}, {10, 0, 0}}, samples, "PeekAt after the CBuffer")
+
+	assert.Equal(5, buffer.Len(), "Used space after PeekAt")
+}
+
+func TestCheckedCBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := multichannel.NewCBuffer(2, 4)
+	samples := multichannel.NewTSMBuffer(1, 2)
+
+	_, err := buffer.CheckedWrite(samples)
+	assert.Equal(multichannel.ErrChannelMismatch, err, "CheckedWrite with the wrong number of channels")
+	_, err = buffer.CheckedPeek(samples)
+	assert.Equal(multichannel.ErrChannelMismatch, err, "CheckedPeek with the wrong number of channels")
+	_, err = buffer.CheckedPeekAt(samples, 1)
+	assert.Equal(multichannel.ErrChannelMismatch, err, "CheckedPeekAt with the wrong number of channels")
+	_, err = buffer.CheckedRead(samples)
+	assert.Equal(multichannel.ErrChannelMismatch, err, "CheckedRead with the wrong number of channels")
+	err = buffer.CheckedAdd(samples)
+	assert.Equal(multichannel.ErrChannelMismatch, err, "CheckedAdd with the wrong number of channels")
+
+	err = buffer.CheckedAdd(multichannel.TSMBuffer{{1, 2, 3, 4, 5}, {1, 2, 3, 4, 5}})
+	assert.Equal(multichannel.ErrNotEnoughSpace, err, "CheckedAdd with a buffer too large")
+
+	buffer.SetReadable(2)
+	out := multichannel.NewTSMBuffer(2, 2)
+	buffer.Read(out)
+	assert.Equal(multichannel.TSMBuffer{{0, 0}, {0, 0}}, out, "CheckedAdd should not modify the buffer on error")
+
+	err = buffer.CheckedSetReadable(5)
+	assert.Equal(multichannel.ErrNotEnoughSpace, err, "CheckedSetReadable with a size too large")
+	err = buffer.CheckedDivide(multichannel.NewNormalizeBuffer(2), 3)
+	assert.Equal(multichannel.ErrOutOfRange, err, "CheckedDivide with a NormalizeBuffer too small")
+
+	n, err := buffer.CheckedWrite(multichannel.TSMBuffer{{1, 2, 3}, {4, 5, 6}})
+	assert.NoError(err, "CheckedWrite")
+	assert.Equal(3, n, "CheckedWrite")
+}
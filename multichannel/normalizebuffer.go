@@ -35,22 +35,46 @@ func NewNormalizeBuffer(n int) NormalizeBuffer {
 }
 
 // Add adds a window element-wise to the buffer.
+//
+// It panics if the window is larger than the buffer (see CheckedAdd).
 func (b *NormalizeBuffer) Add(window []float64) {
+	if err := b.CheckedAdd(window); err != nil {
+		panic(err)
+	}
+}
+
+// CheckedAdd is equivalent to Add, but returns ErrNotEnoughSpace instead of
+// panicking.
+func (b *NormalizeBuffer) CheckedAdd(window []float64) error {
 	if len(window) > len(b.data) {
-		panic("the window should be smaller than the buffer")
+		return ErrNotEnoughSpace
 	}
 
 	for i, v := range window {
 		b.data[(b.pointer+i)%len(b.data)] += v
 	}
+
+	return nil
 }
 
 // Get returns the i-th value of the buffer.
+//
+// It panics if i is out of the bounds of the buffer (see CheckedGet).
 func (b *NormalizeBuffer) Get(i int) float64 {
-	if i < 0 || i > len(b.data) {
-		panic("index out of bounds")
+	v, err := b.CheckedGet(i)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// CheckedGet is equivalent to Get, but returns ErrOutOfRange instead of
+// panicking.
+func (b *NormalizeBuffer) CheckedGet(i int) (float64, error) {
+	if i < 0 || i >= len(b.data) {
+		return 0, ErrOutOfRange
 	}
-	return b.data[(b.pointer+i)%len(b.data)]
+	return b.data[(b.pointer+i)%len(b.data)], nil
 }
 
 // Remove removes the first n values of the buffer.
@@ -84,6 +84,7 @@ var getTests = []getTest{
 
 	{NewNormalizeBuffer(0), 0, true, 0},
 	{NewNormalizeBuffer(2), -1, true, 0},
+	{NewNormalizeBuffer(2), 2, true, 0},
 	{NewNormalizeBuffer(2), 3, true, 0},
 	{NormalizeBuffer{[]float64{1, 2, 3}, 1}, -1, true, 0},
 }
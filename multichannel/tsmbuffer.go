@@ -47,14 +47,22 @@ func NewTSMBuffer(channels int, length int) TSMBuffer {
 // tsm/windows and github.com/mjibson/go-dsp/window), and is applied by
 // multiplying each channel by the window element-wise.
 //
-// ApplyWindow will panic if the buffer and the window have different lengths.
+// ApplyWindow will panic if the buffer and the window have different lengths
+// (see CheckedApplyWindow).
 func (b TSMBuffer) ApplyWindow(window []float64) {
-	if len(b) == 0 {
-		return
+	if err := b.CheckedApplyWindow(window); err != nil {
+		panic(err)
 	}
+}
 
-	if len(b[0]) != len(window) {
-		panic("the buffer and the window should have the same size")
+// CheckedApplyWindow is equivalent to ApplyWindow, but returns
+// ErrLengthMismatch instead of panicking, in which case the buffer is left
+// unchanged.
+func (b TSMBuffer) CheckedApplyWindow(window []float64) error {
+	for k := range b {
+		if len(b[k]) != len(window) {
+			return ErrLengthMismatch
+		}
 	}
 
 	for k := range b {
@@ -62,6 +70,8 @@ func (b TSMBuffer) ApplyWindow(window []float64) {
 			b[k][i] *= v
 		}
 	}
+
+	return nil
 }
 
 // Channel returns the channel-th channel of the buffer.
@@ -82,6 +92,15 @@ func (b TSMBuffer) Len() int {
 	return len(b[0])
 }
 
+// Reverse reverses the order of the samples of each channel of the buffer.
+func (b TSMBuffer) Reverse() {
+	for k := range b {
+		for i, j := 0, len(b[k])-1; i < j; i, j = i+1, j-1 {
+			b[k][i], b[k][j] = b[k][j], b[k][i]
+		}
+	}
+}
+
 // Sample returns the index-th sample of the channel-th channel.
 func (b TSMBuffer) Sample(channel int, index int) float64 {
 	return b[channel][index]
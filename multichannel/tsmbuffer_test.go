@@ -204,6 +204,28 @@ func TestLen(t *testing.T) {
 	}
 }
 
+type reverseTest struct {
+	in  multichannel.TSMBuffer
+	out multichannel.TSMBuffer
+}
+
+var reverseTests = []reverseTest{
+	{multichannel.TSMBuffer{}, multichannel.TSMBuffer{}},
+	{multichannel.TSMBuffer{{}}, multichannel.TSMBuffer{{}}},
+	{multichannel.TSMBuffer{{1}}, multichannel.TSMBuffer{{1}}},
+	{multichannel.TSMBuffer{{1, 2, 3, 4}}, multichannel.TSMBuffer{{4, 3, 2, 1}}},
+	{multichannel.TSMBuffer{{1, 2, 3}, {4, 5, 6}}, multichannel.TSMBuffer{{3, 2, 1}, {6, 5, 4}}},
+}
+
+func TestReverse(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range reverseTests {
+		c.in.Reverse()
+		assert.Equal(c.out, c.in, fmt.Sprintf("Buffer.Reverse (%d)", i))
+	}
+}
+
 type sampleTest struct {
 	in      multichannel.TSMBuffer
 	channel int
@@ -30,6 +30,19 @@ import (
 	"github.com/Muges/go-tsm/window"
 )
 
+func init() {
+	tsm.Register(tsm.Method{
+		Name:        "ola",
+		Description: "Overlap-Add, for percussive signals",
+		Parameters: []tsm.Parameter{
+			tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamPreset,
+			tsm.ParamFrameLength, tsm.ParamSynthesisHop,
+			tsm.ParamAnalysisWindow, tsm.ParamSynthesisWindow,
+		},
+		New: NewWithOptions,
+	})
+}
+
 // An olaConverter implements the conversion of an analysis frame into a
 // synthesis frame for the OLA (Overlap-Add) method.
 type olaConverter struct{}
@@ -52,12 +65,20 @@ func (c olaConverter) Clear() {
 // Read the documentation of the tsm.Settings type for an explanation of the
 // other arguments.
 func New(channels int, analysisHop int, synthesisHop int, frameLength int) (*tsm.TSM, error) {
+	return newTSM(channels, 0, analysisHop, synthesisHop, frameLength, nil, window.Hanning(frameLength))
+}
+
+// newTSM returns a TSM implementing the OLA procedure for a signal sampled at
+// sampleRate Hz.
+func newTSM(channels int, sampleRate int, analysisHop int, synthesisHop int, frameLength int, analysisWindow []float64, synthesisWindow []float64) (*tsm.TSM, error) {
 	return tsm.New(tsm.Settings{
 		Channels:        channels,
+		SampleRate:      sampleRate,
 		AnalysisHop:     analysisHop,
 		SynthesisHop:    synthesisHop,
 		FrameLength:     frameLength,
-		SynthesisWindow: window.Hanning(frameLength),
+		AnalysisWindow:  analysisWindow,
+		SynthesisWindow: synthesisWindow,
 		Converter:       olaConverter{},
 	})
 }
@@ -65,12 +86,12 @@ func New(channels int, analysisHop int, synthesisHop int, frameLength int) (*tsm
 // NewWithSpeed returns a TSM implementing the OLA procedure, modifying the
 // speed of the input signal by the ratio speed.
 //
-// The arguments speed, synthesisHop and frameLength may be strictly negative, in
-// which case they will be replaced by default values.
+// The arguments synthesisHop and frameLength may be strictly negative, in
+// which case they will be replaced by default values. A negative speed plays
+// the signal backwards (see the SetHistory method of tsm.TSM).
+//
+// Deprecated: use NewWithOptions, which does not rely on negative values.
 func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int) (*tsm.TSM, error) {
-	if speed < 0 {
-		speed = 1
-	}
 	if frameLength < 0 {
 		frameLength = 256
 	}
@@ -80,11 +101,51 @@ func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int
 
 	analysisHop := int(float64(synthesisHop) * speed)
 
-	return New(channels, analysisHop, synthesisHop, frameLength)
+	t, err := New(channels, analysisHop, synthesisHop, frameLength)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(speed)
+
+	return t, nil
 }
 
 // Default returns a TSM implementing the OLA procedure with sane default
 // parameters.
 func Default(channels int, speed float64) (*tsm.TSM, error) {
-	return NewWithSpeed(channels, speed, -1, -1)
+	return NewWithOptions(channels, tsm.WithSpeed(speed))
+}
+
+// NewWithOptions returns a TSM implementing the OLA procedure, configured by
+// the options (see tsm.Config). The default frame length is 256 samples at
+// 44.1kHz, the default synthesis hop is half the frame length, and the default
+// synthesis window is a Hanning window. The tolerance is ignored.
+func NewWithOptions(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+	c := tsm.NewConfig(options...)
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	frameLength := c.Length(c.FrameLength, c.FrameDuration, c.Scale(256))
+	synthesisHop := c.Length(c.SynthesisHop, c.SynthesisHopDuration, frameLength/2)
+	analysisHop := int(float64(synthesisHop) * c.Speed)
+	analysisWindow, synthesisWindow := c.Windows(frameLength, nil, window.Hanning)
+
+	t, err := newTSM(channels, c.SampleRate, analysisHop, synthesisHop, frameLength, analysisWindow, synthesisWindow)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(c.Speed)
+
+	return t, nil
+}
+
+// Process changes the speed of a whole signal with the OLA procedure,
+// configured by the options (see NewWithOptions), and returns the result.
+func Process(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error) {
+	t, err := NewWithOptions(input.Channels(), options...)
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Process(t, input)
 }
@@ -0,0 +1,426 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package quality computes objective measures of the quality of a
+// time-scale modification, by comparing a stretched signal with the reference
+// signal from which it was computed.
+//
+// The measures are computed on the magnitude spectrograms of the signals.
+// Since the stretched signal is longer or shorter than the reference, the
+// spectrogram of the reference is warped in time according to the speed
+// ratio, so that each of its frames corresponds to a frame of the stretched
+// signal.
+package quality
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/stft"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+)
+
+// ErrInvalidSpeed is returned by Measure if the speed ratio is not strictly
+// positive.
+var ErrInvalidSpeed = errors.New("invalid speed")
+
+// Settings contains the parameters of the spectrograms from which the measures
+// are computed. Shorter frames and hops give a better time resolution, which
+// is needed to measure the transient smearing.
+type Settings struct {
+	FrameLength int
+	Hop         int
+
+	// DynamicRange is the range (in dB) of the magnitudes that are taken
+	// into account: the magnitudes lower than the maximum magnitude of the
+	// reference minus DynamicRange are raised to this threshold, so that
+	// the differences between silences are ignored.
+	DynamicRange float64
+}
+
+// DefaultSettings are the settings used by Measure, which give a good time
+// resolution at 44.1kHz.
+var DefaultSettings = Settings{
+	FrameLength:  1024,
+	Hop:          128,
+	DynamicRange: 80,
+}
+
+// A Spectrogram contains the magnitudes of the short-time Fourier transform of
+// a signal: s[j][i] is the magnitude of the bin i of the frame j, the power of
+// the channels being averaged. The frames are separated by Settings.Hop
+// samples, the first one being centered on the first sample of the signal.
+type Spectrogram [][]float64
+
+// NewSpectrogram computes the spectrogram of a signal.
+func NewSpectrogram(buffer multichannel.Buffer, s Settings) (Spectrogram, error) {
+	frames, err := stft.Analyze(stft.NewSettings(buffer.Channels(), s.FrameLength, s.Hop, window.Hanning), buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	spectrogram := make(Spectrogram, len(frames))
+	for j, frame := range frames {
+		spectrogram[j] = make([]float64, frame.Bins())
+		for i := range spectrogram[j] {
+			var power float64
+			for k := 0; k < frame.Channels(); k++ {
+				m := frame.Magnitude(k, i)
+				power += m * m
+			}
+			spectrogram[j][i] = math.Sqrt(power / float64(frame.Channels()))
+		}
+	}
+
+	return spectrogram, nil
+}
+
+// Max returns the largest magnitude of the spectrogram.
+func (s Spectrogram) Max() float64 {
+	var max float64
+	for _, frame := range s {
+		for _, v := range frame {
+			max = math.Max(max, v)
+		}
+	}
+	return max
+}
+
+// Warp returns a spectrogram with the given number of frames, whose frame j is
+// the frame j*speed of s (interpolated linearly between the frames of s, and
+// equal to 0 after its end). It is the spectrogram that a perfect time-scale
+// modification of the signal would have.
+func (s Spectrogram) Warp(speed float64, frames int) Spectrogram {
+	bins := 0
+	if len(s) > 0 {
+		bins = len(s[0])
+	}
+
+	warped := make(Spectrogram, frames)
+	for j := range warped {
+		warped[j] = make([]float64, bins)
+
+		position := float64(j) * speed
+		j1 := int(position)
+		ratio := position - float64(j1)
+		for i := range warped[j] {
+			var v1, v2 float64
+			if j1 < len(s) {
+				v1 = s[j1][i]
+			}
+			if j1+1 < len(s) {
+				v2 = s[j1+1][i]
+			}
+			warped[j][i] = (1-ratio)*v1 + ratio*v2
+		}
+	}
+
+	return warped
+}
+
+// SpectralConvergence returns the Frobenius norm of the difference of the
+// spectrograms, relative to the norm of the reference. It is 0 if they are
+// identical. Only the frames that are in both spectrograms are compared.
+func SpectralConvergence(reference Spectrogram, estimate Spectrogram) float64 {
+	var difference, norm float64
+	for j := 0; j < len(reference) && j < len(estimate); j++ {
+		for i, r := range reference[j] {
+			d := estimate[j][i] - r
+			difference += d * d
+			norm += r * r
+		}
+	}
+	if norm == 0 {
+		return 0
+	}
+	return math.Sqrt(difference / norm)
+}
+
+// LogSpectralDistance returns the root mean square of the differences of the
+// magnitudes (in dB) of the frames of the spectrograms, averaged over the
+// frames. The magnitudes lower than floor are replaced by floor. Only the
+// frames that are in both spectrograms are compared.
+func LogSpectralDistance(reference Spectrogram, estimate Spectrogram, floor float64) float64 {
+	var sum float64
+	frames := 0
+	for j := 0; j < len(reference) && j < len(estimate); j++ {
+		var frameSum float64
+		for i, r := range reference[j] {
+			d := decibels(estimate[j][i], floor) - decibels(r, floor)
+			frameSum += d * d
+		}
+		if len(reference[j]) > 0 {
+			sum += math.Sqrt(frameSum / float64(len(reference[j])))
+		}
+		frames++
+	}
+	if frames == 0 {
+		return 0
+	}
+	return sum / float64(frames)
+}
+
+// decibels converts a magnitude to dB, raising it to floor.
+func decibels(v float64, floor float64) float64 {
+	if v < floor {
+		v = floor
+	}
+	return 20 * math.Log10(v)
+}
+
+// Modulation returns the average absolute variation (in dB) of the magnitude
+// of the bins from one frame to the next, weighted by the magnitudes. The
+// magnitudes lower than floor are replaced by floor.
+//
+// The OLA-based methods, and the phase vocoder, may introduce modulations in
+// stationary sounds when the phases of the overlapping frames do not match,
+// which is heard as phasiness or reverberation. The difference between the
+// modulation of the stretched signal and the one of the warped reference
+// measures these artifacts.
+func Modulation(s Spectrogram, floor float64) float64 {
+	var sum, weights float64
+	for j := 1; j < len(s); j++ {
+		for i, v := range s[j] {
+			weight := math.Max(v, floor) + math.Max(s[j-1][i], floor)
+			sum += weight * math.Abs(decibels(v, floor)-decibels(s[j-1][i], floor))
+			weights += weight
+		}
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// Flux returns the positive spectral flux of the spectrogram, i.e. the sum of
+// the increases of the magnitudes of the bins between each frame and the
+// previous one (the first frame being compared with silence).
+func Flux(s Spectrogram) []float64 {
+	flux := make([]float64, len(s))
+	for j := range s {
+		for i, v := range s[j] {
+			var previous float64
+			if j > 0 {
+				previous = s[j-1][i]
+			}
+			if v > previous {
+				flux[j] += v - previous
+			}
+		}
+	}
+	return flux
+}
+
+// Onsets returns the frames of the transients of a spectrogram, which are the
+// peaks of its positive spectral flux larger than three times its median and
+// than a tenth of its maximum. Two onsets are separated by at least
+// minDistance frames.
+func Onsets(s Spectrogram, minDistance int) []int {
+	flux := Flux(s)
+	if len(flux) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64(nil), flux...)
+	sort.Float64s(sorted)
+	threshold := math.Max(3*sorted[len(sorted)/2], 0.1*sorted[len(sorted)-1])
+	if threshold <= 0 {
+		return nil
+	}
+
+	var onsets []int
+	for j, v := range flux {
+		if v < threshold || !isPeak(flux, j, minDistance) {
+			continue
+		}
+		if len(onsets) > 0 && j-onsets[len(onsets)-1] < minDistance {
+			continue
+		}
+		onsets = append(onsets, j)
+	}
+	return onsets
+}
+
+// isPeak returns true if values[j] is the largest value in [j-distance,
+// j+distance] (the first one in case of equality).
+func isPeak(values []float64, j int, distance int) bool {
+	for i := j - distance; i <= j+distance; i++ {
+		if i < 0 || i >= len(values) || i == j {
+			continue
+		}
+		if values[i] > values[j] || (values[i] == values[j] && i < j) {
+			return false
+		}
+	}
+	return true
+}
+
+// spread returns the standard deviation (in frames) of the values in [center-
+// radius, center+radius], considered as a distribution, and the number of
+// their peaks larger than half their maximum.
+func spread(values []float64, center int, radius int) (float64, int) {
+	first, last := center-radius, center+radius+1
+	if first < 0 {
+		first = 0
+	}
+	if last > len(values) {
+		last = len(values)
+	}
+	if first >= last {
+		return 0, 0
+	}
+	values = values[first:last]
+
+	var sum, mean, max float64
+	for i, v := range values {
+		sum += v
+		mean += float64(i) * v
+		max = math.Max(max, v)
+	}
+	if sum == 0 {
+		return 0, 0
+	}
+	mean /= sum
+
+	var variance float64
+	peaks := 0
+	for i, v := range values {
+		variance += v * (float64(i) - mean) * (float64(i) - mean)
+		if v >= max/2 && isPeak(values, i, 1) {
+			peaks++
+		}
+	}
+
+	return math.Sqrt(variance / sum), peaks
+}
+
+// A Report contains the measures computed by Measure.
+type Report struct {
+	// SpectralConvergence and LogSpectralDistance (in dB) measure the
+	// difference between the spectrogram of the stretched signal and the
+	// warped spectrogram of the reference. They are 0 for identical
+	// spectrograms.
+	SpectralConvergence float64
+	LogSpectralDistance float64
+
+	// Phasiness is the difference between the Modulation (in dB) of the
+	// stretched signal and the one of the warped reference. It is larger
+	// than 0 if the stretched signal has spurious amplitude modulations.
+	Phasiness float64
+
+	// Transients is the number of transients detected in the reference.
+	// TransientSmearing is the ratio of the spread of the spectral flux
+	// around the transients in the stretched signal to the one in the
+	// reference, which is 1 if the transients are preserved and larger if
+	// they are smeared. TransientDoubling is the fraction of the transients
+	// which have several peaks in the stretched signal. They are both 0 if
+	// there are no transients.
+	Transients        int
+	TransientSmearing float64
+	TransientDoubling float64
+
+	// DurationError is the difference between the length of the stretched
+	// signal and the expected one (the length of the reference divided by
+	// the speed), in samples, and RelativeDurationError the same difference
+	// relative to the expected length.
+	DurationError         int
+	RelativeDurationError float64
+}
+
+// Measure compares a stretched signal with the reference signal from which it
+// was computed with the given speed ratio, using the DefaultSettings.
+func Measure(reference multichannel.Buffer, stretched multichannel.Buffer, speed float64) (Report, error) {
+	return MeasureWithSettings(reference, stretched, speed, DefaultSettings)
+}
+
+// MeasureWithSettings is equivalent to Measure, but computes the spectrograms
+// with the given settings.
+//
+// An error wrapping ErrInvalidSpeed is returned if the speed is not strictly
+// positive (a signal played backwards should be reversed before being
+// compared), an error wrapping multichannel.ErrChannelMismatch if the signals
+// do not have the same number of channels, and an error wrapping one of the
+// errors of the stft package if the settings are invalid.
+func MeasureWithSettings(reference multichannel.Buffer, stretched multichannel.Buffer, speed float64, s Settings) (Report, error) {
+	var report Report
+
+	if speed <= 0 {
+		return report, errors.Wrapf(ErrInvalidSpeed, "the speed should be strictly positive, got %g", speed)
+	}
+	if reference.Channels() != stretched.Channels() {
+		return report, errors.Wrapf(multichannel.ErrChannelMismatch, "the stretched signal should have %d channels, got %d", reference.Channels(), stretched.Channels())
+	}
+
+	expected := float64(reference.Len()) / speed
+	report.DurationError = stretched.Len() - int(math.Floor(expected+0.5))
+	if expected > 0 {
+		report.RelativeDurationError = (float64(stretched.Len()) - expected) / expected
+	}
+
+	referenceSpectrogram, err := NewSpectrogram(reference, s)
+	if err != nil {
+		return report, err
+	}
+	estimate, err := NewSpectrogram(stretched, s)
+	if err != nil {
+		return report, err
+	}
+	warped := referenceSpectrogram.Warp(speed, len(estimate))
+
+	floor := referenceSpectrogram.Max() * math.Pow(10, -s.DynamicRange/20)
+	if floor <= 0 {
+		floor = 1e-10
+	}
+	report.SpectralConvergence = SpectralConvergence(warped, estimate)
+	report.LogSpectralDistance = LogSpectralDistance(warped, estimate, floor)
+	report.Phasiness = Modulation(estimate, floor) - Modulation(warped, floor)
+
+	// Compare the spread of the spectral flux around the transients, in
+	// samples since the transients should not be stretched
+	radius := s.FrameLength / s.Hop
+	referenceFlux, estimateFlux := Flux(referenceSpectrogram), Flux(estimate)
+	var referenceSpread, estimateSpread float64
+	doubled := 0
+	for _, onset := range Onsets(referenceSpectrogram, radius) {
+		// The frames overlapping with the end of the signal are padded
+		// with zeros, which gives spurious onsets
+		if onset*s.Hop+s.FrameLength/2 > reference.Len() {
+			continue
+		}
+
+		r, _ := spread(referenceFlux, onset, radius)
+		e, peaks := spread(estimateFlux, int(math.Floor(float64(onset)/speed+0.5)), radius)
+		referenceSpread += r
+		estimateSpread += e
+		if peaks > 1 {
+			doubled++
+		}
+		report.Transients++
+	}
+	if report.Transients > 0 {
+		if referenceSpread > 0 {
+			report.TransientSmearing = estimateSpread / referenceSpread
+		}
+		report.TransientDoubling = float64(doubled) / float64(report.Transients)
+	}
+
+	return report, nil
+}
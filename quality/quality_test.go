@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package quality_test
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/quality"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// chord returns a chord with a click every 11025 samples, starting at the
+// sample 5000. If doubled is true, each click is repeated 600 samples later.
+func chord(length int, doubled bool) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(1, length)
+	for i := range buffer[0] {
+		buffer[0][i] = 0.3*math.Sin(2*math.Pi*440*float64(i)/44100) + 0.2*math.Sin(2*math.Pi*660*float64(i)/44100)
+
+		j := (i + 11025 - 5000) % 11025
+		if j < 50 {
+			buffer[0][i] += 0.5 * (1 - float64(j)/50)
+		}
+		if doubled && j >= 600 && j < 650 {
+			buffer[0][i] += 0.5 * (1 - float64(j-600)/50)
+		}
+	}
+	return buffer
+}
+
+func TestMeasure(t *testing.T) {
+	assert := assert.New(t)
+
+	reference := chord(44100, false)
+
+	// A signal is a perfect stretching of itself
+	report, err := quality.Measure(reference, reference, 1)
+	if assert.NoError(err) {
+		assert.InDelta(0, report.SpectralConvergence, 1e-9)
+		assert.InDelta(0, report.LogSpectralDistance, 1e-9)
+		assert.InDelta(0, report.Phasiness, 1e-9)
+		// The start of the chord, and the clicks
+		assert.Equal(5, report.Transients)
+		assert.InDelta(1, report.TransientSmearing, 1e-9)
+		assert.Equal(0.0, report.TransientDoubling)
+		assert.Equal(0, report.DurationError)
+	}
+
+	// Doubled transients
+	report, err = quality.Measure(reference, chord(44100, true), 1)
+	if assert.NoError(err) {
+		assert.Equal(0.8, report.TransientDoubling)
+		assert.True(report.TransientSmearing > 1.5)
+	}
+
+	// Attenuated signal
+	attenuated := chord(44100, false)
+	for i := range attenuated[0] {
+		attenuated[0][i] *= 0.5
+	}
+	report, err = quality.Measure(reference, attenuated, 1)
+	if assert.NoError(err) {
+		assert.InDelta(0.5, report.SpectralConvergence, 1e-9)
+		assert.True(report.LogSpectralDistance > 0)
+	}
+
+	// Duration
+	report, err = quality.Measure(reference, chord(88200+10, false), 0.5)
+	if assert.NoError(err) {
+		assert.Equal(10, report.DurationError)
+		assert.InDelta(10.0/88200, report.RelativeDurationError, 1e-12)
+	}
+}
+
+func TestMeasureMethods(t *testing.T) {
+	assert := assert.New(t)
+
+	reference := chord(44100, false)
+	olaOutput, err := ola.Process(reference, tsm.WithSpeed(0.5))
+	if !assert.NoError(err) {
+		return
+	}
+	wsolaOutput, err := wsola.Process(reference, tsm.WithSpeed(0.5))
+	if !assert.NoError(err) {
+		return
+	}
+
+	olaReport, err := quality.Measure(reference, olaOutput, 0.5)
+	assert.NoError(err)
+	wsolaReport, err := quality.Measure(reference, wsolaOutput, 0.5)
+	assert.NoError(err)
+
+	// WSOLA preserves the harmonic signals better than OLA, but doubles the
+	// transients
+	assert.True(wsolaReport.SpectralConvergence < olaReport.SpectralConvergence)
+	assert.True(wsolaReport.LogSpectralDistance < olaReport.LogSpectralDistance)
+	assert.True(wsolaReport.TransientDoubling > olaReport.TransientDoubling)
+	assert.Equal(0, olaReport.DurationError)
+	assert.Equal(0, wsolaReport.DurationError)
+}
+
+func TestMeasureErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	reference := chord(1000, false)
+
+	_, err := quality.Measure(reference, reference, 0)
+	assert.True(errors.Is(err, quality.ErrInvalidSpeed))
+	_, err = quality.Measure(reference, reference, -1)
+	assert.True(errors.Is(err, quality.ErrInvalidSpeed))
+	_, err = quality.Measure(reference, multichannel.NewTSMBuffer(2, 1000), 1)
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch))
+}
+
+func TestWarp(t *testing.T) {
+	assert := assert.New(t)
+
+	s := quality.Spectrogram{{0, 1}, {2, 3}, {4, 5}}
+	assert.Equal(quality.Spectrogram{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}, {2, 2.5}}, s.Warp(0.5, 6))
+	assert.Equal(quality.Spectrogram{{0, 1}, {4, 5}}, s.Warp(2, 2))
+	assert.Equal(quality.Spectrogram{}, quality.Spectrogram{}.Warp(2, 0))
+}
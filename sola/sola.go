@@ -0,0 +1,248 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package sola implements the SOLA (Synchronized Overlap-Add) time-scale
+// modification procedure.
+//
+// SOLA works in the same way as OLA, except that the position of each frame in
+// the output signal is allowed to vary slightly, in order to align it with the
+// samples that were already synthesized. The frames are cross-faded linearly
+// where they overlap. It is cheaper than WSOLA, and gives good results on
+// speech signals.
+package sola
+
+import (
+	"github.com/Muges/go-tsm/internal/correlation"
+	"github.com/Muges/go-tsm/internal/parallel"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	tsm.Register(tsm.Method{
+		Name:        "sola",
+		Description: "Synchronized Overlap-Add, for speech signals",
+		Parameters: []tsm.Parameter{
+			tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamPreset,
+			tsm.ParamFrameLength, tsm.ParamSynthesisHop, tsm.ParamTolerance,
+		},
+		New: NewWithOptions,
+	})
+}
+
+// A solaConverter implements the conversion of an analysis frame into a
+// synthesis frame for the SOLA (Synchronized Overlap-Add) method.
+//
+// Since the synthesis position of the frames is variable, the overlap-add step
+// cannot be handled by the TSM object. The TSM is therefore configured with a
+// FrameLength equal to the synthesis hop and no windows, and the converter
+// overlaps and adds the frames itself in the tail buffer, which contains the
+// samples that were synthesized but not yet returned.
+type solaConverter struct {
+	frameLength  int
+	synthesisHop int
+	tolerance    int
+
+	tail           [][]float64
+	tailLength     []int
+	synthesisFrame multichannel.TSMBuffer
+}
+
+// bestShift returns the shift of the interval [0, tolerance] that maximizes the
+// normalized cross-correlation of tail[shift:] and frame. The shift is always
+// lower than len(tail), so that the frame overlaps with the tail.
+func bestShift(tail []float64, frame []float64, tolerance int) int {
+	if tolerance > len(tail)-1 {
+		tolerance = len(tail) - 1
+	}
+	if tolerance <= 0 {
+		return 0
+	}
+
+	var maxShift int
+	var maxValue float64
+	for shift, value := range correlation.Normalized(frame, tail, tolerance) {
+		if value > maxValue {
+			maxValue = value
+			maxShift = shift
+		}
+	}
+
+	return maxShift
+}
+
+// Convert overlaps and adds the analysis frame in the tail, at the position
+// that aligns it best with the samples that were already synthesized, and
+// returns the next synthesisHop samples of the tail.
+func (c *solaConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	parallel.ForEachChannel(analysisFrame.Channels(), c.tolerance*c.frameLength, func(k int) {
+		frame := analysisFrame[k][:c.frameLength]
+		tail := c.tail[k]
+		length := c.tailLength[k]
+
+		shift := 0
+		if length > 0 {
+			shift = bestShift(tail[:length], frame, c.tolerance)
+		}
+
+		// Cross-fade the frame with the tail where they overlap, and copy
+		// the rest of the frame after it
+		overlap := length - shift
+		for i := 0; i < overlap; i++ {
+			ratio := float64(i) / float64(overlap)
+			tail[shift+i] = (1-ratio)*tail[shift+i] + ratio*frame[i]
+		}
+		copy(tail[shift+overlap:], frame[overlap:])
+		length = shift + c.frameLength
+
+		// Output the first synthesisHop samples of the tail
+		copy(c.synthesisFrame[k], tail[:c.synthesisHop])
+		copy(tail, tail[c.synthesisHop:length])
+		c.tailLength[k] = length - c.synthesisHop
+	})
+
+	return c.synthesisFrame
+}
+
+// Clear clears the state of the Converter, making it ready to be used on
+// another signal (or another part of a signal). It is automatically called by
+// the Flush, Clear and New methods of the TSM object.
+func (c *solaConverter) Clear() {
+	for k := range c.tail {
+		for i := range c.tail[k] {
+			c.tail[k][i] = 0
+		}
+		c.tailLength[k] = 0
+	}
+}
+
+// New returns a TSM implementing the SOLA procedure.
+//
+// channels is the number of channels of the signal that the TSM will process.
+// tolerance is the maximum number of samples that the synthesis position of a
+// frame can be delayed, and should be between 0 and synthesisHop. frameLength
+// should be larger than synthesisHop. Read the documentation of the
+// tsm.Settings type for an explanation of the other arguments.
+func New(channels int, analysisHop int, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
+	converter := &solaConverter{
+		frameLength:  frameLength,
+		synthesisHop: synthesisHop,
+		tolerance:    tolerance,
+	}
+	settings := tsm.Settings{
+		Channels:     channels,
+		AnalysisHop:  analysisHop,
+		SynthesisHop: synthesisHop,
+		FrameLength:  synthesisHop,
+
+		DeltaAfter: frameLength - synthesisHop,
+
+		Converter: converter,
+	}
+
+	if frameLength <= synthesisHop {
+		return nil, errors.Wrapf(tsm.ErrInvalidFrameLength, "the frame length (%d) should be larger than the synthesis hop (%d)", frameLength, synthesisHop)
+	}
+	if tolerance < 0 || tolerance > synthesisHop {
+		return nil, errors.Wrapf(tsm.ErrInvalidParameter, "the tolerance (%d) should be between 0 and the synthesis hop (%d)", tolerance, synthesisHop)
+	}
+
+	// Validate the settings before allocating the buffers of the converter
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	converter.tail = multichannel.NewTSMBuffer(channels, frameLength+tolerance)
+	converter.tailLength = make([]int, channels)
+	converter.synthesisFrame = multichannel.NewTSMBuffer(channels, synthesisHop)
+
+	return tsm.New(settings)
+}
+
+// NewWithSpeed returns a TSM implementing the SOLA procedure, modifying the
+// speed of the input signal by the ratio speed.
+//
+// The arguments synthesisHop, frameLength and tolerance may be strictly
+// negative, in which case they will be replaced by default values. A negative
+// speed plays the signal backwards (see the SetHistory method of tsm.TSM).
+//
+// Deprecated: use NewWithOptions, which does not rely on negative values.
+func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
+	if frameLength < 0 {
+		frameLength = 1024
+	}
+	if synthesisHop < 0 {
+		synthesisHop = frameLength / 2
+	}
+	if tolerance < 0 {
+		tolerance = frameLength / 4
+	}
+
+	analysisHop := int(float64(synthesisHop) * speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(speed)
+
+	return t, nil
+}
+
+// Default returns a TSM implementing the SOLA procedure with sane default
+// parameters.
+func Default(channels int, speed float64) (*tsm.TSM, error) {
+	return NewWithOptions(channels, tsm.WithSpeed(speed))
+}
+
+// NewWithOptions returns a TSM implementing the SOLA procedure, configured by
+// the options (see tsm.Config). The default frame length is 1024 samples at
+// 44.1kHz, the default synthesis hop is half the frame length, and the default
+// tolerance is a quarter of the frame length. The windows are ignored.
+func NewWithOptions(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+	c := tsm.NewConfig(options...)
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	frameLength := c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024))
+	synthesisHop := c.Length(c.SynthesisHop, c.SynthesisHopDuration, frameLength/2)
+	tolerance := c.Length(c.Tolerance, c.ToleranceDuration, frameLength/4)
+	analysisHop := int(float64(synthesisHop) * c.Speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(c.Speed)
+
+	return t, nil
+}
+
+// Process changes the speed of a whole signal with the SOLA procedure,
+// configured by the options (see NewWithOptions), and returns the result.
+func Process(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error) {
+	t, err := NewWithOptions(input.Channels(), options...)
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Process(t, input)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package sola
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type bestShiftTest struct {
+	tail      []float64
+	frame     []float64
+	tolerance int
+
+	out int
+}
+
+var bestShiftTests = []bestShiftTest{
+	{[]float64{0, 0, 0}, []float64{1, 1, 1}, 2, 0},
+	{[]float64{1, 2, 3}, []float64{1, 2, 3}, 2, 0},
+	{[]float64{0, 0, 1, -1}, []float64{1, -1, 0, 0}, 3, 2},
+	{[]float64{0, 0, 1, -1}, []float64{1, -1, 0, 0}, 1, 0},
+	{[]float64{1}, []float64{1}, 5, 0},
+}
+
+func TestBestShift(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range bestShiftTests {
+		out := bestShift(c.tail, c.frame, c.tolerance)
+		assert.Equal(c.out, out, fmt.Sprintf("bestShift (%d)", i))
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(1, 256, 256, 256, 128)
+	assert.True(errors.Is(err, tsm.ErrInvalidFrameLength), "frame length equal to the synthesis hop")
+
+	_, err = New(1, 256, 256, 1024, 512)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter), "tolerance larger than the synthesis hop")
+
+	_, err = New(1, 256, 512, 1024, -1)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter), "negative tolerance")
+
+	_, err = New(-1, 256, 512, 1024, 256)
+	assert.True(errors.Is(err, tsm.ErrInvalidChannels), "negative number of channels")
+
+	_, err = New(1, 256, 512, 1024, 256)
+	assert.NoError(err)
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package solafs implements the SOLAFS (Synchronized Overlap-Add, Fixed
+// Synthesis) time-scale modification procedure.
+//
+// SOLAFS works in the same way as OLA, with the exception that it allows slight
+// shift of the position of the analysis frames, in order to align them with
+// the part of the previous synthesis frame that they will overlap. Contrary to
+// WSOLA, which compares the analysis frames with the natural progression of
+// the previous one, SOLAFS only compares the overlapping parts of the frames,
+// which makes it cheaper.
+package solafs
+
+import (
+	"github.com/Muges/go-tsm/internal/correlation"
+	"github.com/Muges/go-tsm/internal/parallel"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+)
+
+func init() {
+	tsm.Register(tsm.Method{
+		Name:        "solafs",
+		Description: "Synchronized Overlap-Add with Fixed Synthesis, for speech signals",
+		Parameters: []tsm.Parameter{
+			tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamPreset,
+			tsm.ParamFrameLength, tsm.ParamSynthesisHop, tsm.ParamTolerance,
+		},
+		New: NewWithOptions,
+	})
+}
+
+// A solafsConverter implements the conversion of an analysis frame into a
+// synthesis frame for the SOLAFS (Synchronized Overlap-Add, Fixed Synthesis)
+// method.
+type solafsConverter struct {
+	frameLength  int
+	synthesisHop int
+	tolerance    int
+
+	// overlap contains the part of the previous synthesis frame that overlaps
+	// with the next one.
+	overlap multichannel.TSMBuffer
+}
+
+// bestDelta returns the value delta of the interval [0, 2*tolerance] that
+// maximizes the normalized cross-correlation of reference and
+// buffer[delta:delta+len(reference)], or tolerance if none of them is positive.
+func bestDelta(reference []float64, buffer []float64, tolerance int) int {
+	maxDelta := tolerance
+	var maxValue float64
+	for delta, value := range correlation.Normalized(reference, buffer, 2*tolerance) {
+		if value > maxValue {
+			maxValue = value
+			maxDelta = delta
+		}
+	}
+
+	return maxDelta
+}
+
+// Convert creates the synthesis frame by taking the part of the analysis frame
+// which aligns best with the end of the previous synthesis frame.
+func (c *solafsConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	synthesisFrame := make([][]float64, analysisFrame.Channels())
+
+	parallel.ForEachChannel(analysisFrame.Channels(), 2*c.tolerance*(c.frameLength-c.synthesisHop), func(k int) {
+		delta := bestDelta(c.overlap[k], analysisFrame[k], c.tolerance)
+
+		copy(c.overlap[k], analysisFrame[k][delta+c.synthesisHop:delta+c.frameLength])
+
+		synthesisFrame[k] = analysisFrame[k][delta : delta+c.frameLength]
+	})
+
+	return synthesisFrame
+}
+
+// Clear clears the state of the Converter, making it ready to be used on
+// another signal (or another part of a signal). It is automatically called by
+// the Flush, Clear and New methods of the TSM object.
+func (c *solafsConverter) Clear() {
+	for k := range c.overlap {
+		for i := range c.overlap[k] {
+			c.overlap[k][i] = 0
+		}
+	}
+}
+
+// New returns a TSM implementing the SOLAFS procedure.
+//
+// channels is the number of channels of the signal that the TSM will process.
+// tolerance is the maximum number of samples that the analysis frame can be
+// shifted. Read the documentation of the tsm.Settings type for an explanation
+// of the other arguments.
+func New(channels int, analysisHop int, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
+	converter := &solafsConverter{
+		frameLength:  frameLength,
+		synthesisHop: synthesisHop,
+		tolerance:    tolerance,
+	}
+	settings := tsm.Settings{
+		Channels:     channels,
+		AnalysisHop:  analysisHop,
+		SynthesisHop: synthesisHop,
+		FrameLength:  frameLength,
+
+		DeltaBefore: tolerance,
+		DeltaAfter:  tolerance,
+
+		Converter: converter,
+	}
+
+	// Validate the settings before allocating the buffers of the converter
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	converter.overlap = multichannel.NewTSMBuffer(channels, frameLength-synthesisHop)
+	settings.SynthesisWindow = window.Hanning(frameLength)
+
+	return tsm.New(settings)
+}
+
+// NewWithSpeed returns a TSM implementing the SOLAFS procedure, modifying the
+// speed of the input signal by the ratio speed.
+//
+// The arguments synthesisHop, frameLength and tolerance may be strictly
+// negative, in which case they will be replaced by default values. A negative
+// speed plays the signal backwards (see the SetHistory method of tsm.TSM).
+//
+// Deprecated: use NewWithOptions, which does not rely on negative values.
+func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
+	if frameLength < 0 {
+		frameLength = 1024
+	}
+	if synthesisHop < 0 {
+		synthesisHop = frameLength / 2
+	}
+	if tolerance < 0 {
+		tolerance = frameLength / 4
+	}
+
+	analysisHop := int(float64(synthesisHop) * speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(speed)
+
+	return t, nil
+}
+
+// Default returns a TSM implementing the SOLAFS procedure with sane default
+// parameters.
+func Default(channels int, speed float64) (*tsm.TSM, error) {
+	return NewWithOptions(channels, tsm.WithSpeed(speed))
+}
+
+// NewWithOptions returns a TSM implementing the SOLAFS procedure, configured by
+// the options (see tsm.Config). The default frame length is 1024 samples at
+// 44.1kHz, the default synthesis hop is half the frame length, and the default
+// tolerance is a quarter of the frame length. The windows are ignored.
+func NewWithOptions(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+	c := tsm.NewConfig(options...)
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	frameLength := c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024))
+	synthesisHop := c.Length(c.SynthesisHop, c.SynthesisHopDuration, frameLength/2)
+	tolerance := c.Length(c.Tolerance, c.ToleranceDuration, frameLength/4)
+	analysisHop := int(float64(synthesisHop) * c.Speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(c.Speed)
+
+	return t, nil
+}
+
+// Process changes the speed of a whole signal with the SOLAFS procedure,
+// configured by the options (see NewWithOptions), and returns the result.
+func Process(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error) {
+	t, err := NewWithOptions(input.Channels(), options...)
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Process(t, input)
+}
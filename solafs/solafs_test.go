@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package solafs
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type bestDeltaTest struct {
+	reference []float64
+	buffer    []float64
+	tolerance int
+
+	out int
+}
+
+var bestDeltaTests = []bestDeltaTest{
+	{[]float64{0, 0}, []float64{0, 0, 0, 0}, 1, 1},
+	{[]float64{1, -1}, []float64{0, 0, 0, 0}, 1, 1},
+	{[]float64{1, -1}, []float64{0, 1, -1, 0}, 1, 1},
+	{[]float64{1, 0}, []float64{0, 5, 1, 1}, 1, 1},
+	{[]float64{1, 1}, []float64{3, 0, 1, 1}, 1, 2},
+	{[]float64{1}, []float64{1, 0, 0, 0, 0}, 2, 0},
+}
+
+func TestBestDelta(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range bestDeltaTests {
+		out := bestDelta(c.reference, c.buffer, c.tolerance)
+		assert.Equal(c.out, out, fmt.Sprintf("bestDelta (%d)", i))
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(-1, 256, 256, 512, 128)
+	assert.True(errors.Is(err, tsm.ErrInvalidChannels), "negative number of channels")
+
+	_, err = New(1, 256, 512, 256, 0)
+	assert.True(errors.Is(err, tsm.ErrInvalidFrameLength), "frame length smaller than the synthesis hop")
+
+	_, err = New(1, 256, 256, 512, -1)
+	assert.True(errors.Is(err, tsm.ErrInvalidDelta), "negative tolerance")
+
+	_, err = New(1, 256, 256, 512, 128)
+	assert.NoError(err)
+}
@@ -0,0 +1,499 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package speech implements a time-scale modification procedure optimized for
+// speech signals, similar to the one used by the Sonic library
+// (https://github.com/waywardgeek/sonic).
+//
+// Instead of working on fixed-size frames, it detects the pitch period of the
+// signal with the AMDF (Average Magnitude Difference Function), and removes or
+// duplicates whole pitch periods. This gives high quality results when
+// speeding up speech, at a very low computational cost.
+package speech
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"math"
+)
+
+const (
+	// defaultMinPeriod and defaultMaxPeriod are the pitch periods of a 400Hz
+	// and of a 65Hz signal sampled at 44.1kHz.
+	defaultMinPeriod = 110
+	defaultMaxPeriod = 678
+
+	defaultSynthesisHop = 256
+
+	// maxSpeed is the maximum speed for which the TSM keeps enough samples in
+	// its input buffer to give each of them to the converter.
+	maxSpeed = 8
+)
+
+func init() {
+	tsm.Register(tsm.Method{
+		Name:        "speech",
+		Description: "pitch period based method, for speech signals",
+		Parameters: []tsm.Parameter{
+			tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamSynthesisHop,
+		},
+		New: NewWithOptions,
+	})
+}
+
+// A speechConverter implements the conversion of an analysis frame into a
+// synthesis frame for the speech procedure.
+//
+// The TSM object is configured with a FrameLength equal to the synthesis hop,
+// no windows, and a DeltaAfter large enough for the first analysisHop samples
+// of each analysis frame to be the samples that were added to the input since
+// the previous frame. The converter appends them to its input buffer, changes
+// the speed of the input buffer continuously and stores the result in its
+// output buffer, from which it takes the synthesis frames.
+type speechConverter struct {
+	synthesisHop int
+	analysisHop  int
+	minPeriod    int
+	maxPeriod    int
+
+	input         [][]float64
+	output        [][]float64
+	mono          []float64
+	downsampled   []float64
+	inputPosition int
+
+	// remainingInputToCopy is the number of input samples that should be
+	// copied to the output before removing or duplicating another pitch
+	// period.
+	remainingInputToCopy int
+
+	// remainder is the fractional part of the numbers of samples that were
+	// rounded, which is kept to avoid a drift of the speed.
+	remainder float64
+
+	// started is set to true when the output buffer contains enough samples
+	// to start returning synthesis frames. delay is the number of silent
+	// samples that were returned instead of the output.
+	started bool
+	delay   int
+
+	synthesisFrame multichannel.TSMBuffer
+}
+
+// amdf returns the average magnitude difference of samples for the given
+// period, i.e. the average of |samples[i] - samples[i+period]| for i in [0,
+// period).
+func amdf(samples []float64, period int) float64 {
+	var diff float64
+	for i := 0; i < period; i++ {
+		diff += math.Abs(samples[i] - samples[i+period])
+	}
+	return diff / float64(period)
+}
+
+// bestPeriod returns the period of the interval [minPeriod, maxPeriod] that
+// minimizes the AMDF of samples. samples should contain at least 2*maxPeriod
+// values.
+func bestPeriod(samples []float64, minPeriod int, maxPeriod int) int {
+	if minPeriod < 1 {
+		minPeriod = 1
+	}
+
+	best := minPeriod
+	minDiff := math.Inf(1)
+	for period := minPeriod; period <= maxPeriod; period++ {
+		diff := amdf(samples, period)
+		if diff < minDiff {
+			minDiff = diff
+			best = period
+		}
+	}
+
+	return best
+}
+
+// findPitchPeriod returns the pitch period of the mono signal at the beginning
+// of samples.
+//
+// To reduce the computational cost, the period is first searched on a
+// downsampled version of the signal, and then refined on the original one.
+func (c *speechConverter) findPitchPeriod(samples []float64) int {
+	skip := c.minPeriod / 10
+	if skip <= 1 {
+		return bestPeriod(samples, c.minPeriod, c.maxPeriod)
+	}
+
+	length := 2 * c.maxPeriod / skip
+	c.downsampled = c.downsampled[:0]
+	for i := 0; i < length; i++ {
+		var sum float64
+		for _, v := range samples[i*skip : (i+1)*skip] {
+			sum += v
+		}
+		c.downsampled = append(c.downsampled, sum/float64(skip))
+	}
+
+	period := skip * bestPeriod(c.downsampled, c.minPeriod/skip, c.maxPeriod/skip)
+
+	minPeriod := period - skip
+	if minPeriod < c.minPeriod {
+		minPeriod = c.minPeriod
+	}
+	maxPeriod := period + skip
+	if maxPeriod > c.maxPeriod {
+		maxPeriod = c.maxPeriod
+	}
+
+	return bestPeriod(samples, minPeriod, maxPeriod)
+}
+
+// round rounds x down to an integer, keeping track of the rounding errors so
+// that they compensate each other over time.
+func (c *speechConverter) round(x float64) int {
+	x += c.remainder
+	n := int(x)
+	c.remainder = x - float64(n)
+	return n
+}
+
+// overlapAdd appends to the output n samples cross-fading linearly from the
+// input samples starting at down to the ones starting at up.
+func (c *speechConverter) overlapAdd(n int, down int, up int) {
+	for k := range c.output {
+		for i := 0; i < n; i++ {
+			ratio := float64(i) / float64(n)
+			v := (1-ratio)*c.input[k][down+i] + ratio*c.input[k][up+i]
+			c.output[k] = append(c.output[k], v)
+		}
+	}
+}
+
+// copyInput appends n input samples to the output, starting at the current
+// input position, and moves the input position forward.
+func (c *speechConverter) copyInput(n int) {
+	for k := range c.output {
+		c.output[k] = append(c.output[k], c.input[k][c.inputPosition:c.inputPosition+n]...)
+	}
+	c.inputPosition += n
+}
+
+// skipPitchPeriod removes a pitch period from the input, by cross-fading it
+// with the next one.
+func (c *speechConverter) skipPitchPeriod(speed float64, period int) {
+	var n int
+	if speed >= 2 {
+		n = c.round(float64(period) / (speed - 1))
+	} else {
+		n = period
+		c.remainingInputToCopy = c.round(float64(period) * (2 - speed) / (speed - 1))
+	}
+
+	c.overlapAdd(n, c.inputPosition, c.inputPosition+period)
+	c.inputPosition += period + n
+}
+
+// insertPitchPeriod duplicates a pitch period of the input, by cross-fading
+// the next pitch period with it.
+func (c *speechConverter) insertPitchPeriod(speed float64, period int) {
+	var n int
+	if speed < 0.5 {
+		n = c.round(float64(period) * speed / (1 - speed))
+		if n < 1 {
+			n = 1
+		}
+	} else {
+		n = period
+		c.remainingInputToCopy = c.round(float64(period) * (2*speed - 1) / (1 - speed))
+	}
+
+	for k := range c.output {
+		c.output[k] = append(c.output[k], c.input[k][c.inputPosition:c.inputPosition+period]...)
+	}
+	c.overlapAdd(n, c.inputPosition+period, c.inputPosition)
+	c.inputPosition += n
+}
+
+// changeSpeed processes the samples of the input buffer, and writes the
+// result to the output buffer.
+func (c *speechConverter) changeSpeed(speed float64) {
+	required := 2 * c.maxPeriod
+	outputLimit := 2*required + c.synthesisHop
+
+	for len(c.input[0])-c.inputPosition >= required && len(c.output[0]) < outputLimit {
+		if speed == 1 {
+			c.copyInput(required)
+			continue
+		}
+
+		if c.remainingInputToCopy > 0 {
+			n := c.remainingInputToCopy
+			if n > required {
+				n = required
+			}
+			c.copyInput(n)
+			c.remainingInputToCopy -= n
+			continue
+		}
+
+		// Compute the pitch period on the average of the channels
+		c.mono = c.mono[:0]
+		for i := 0; i < required; i++ {
+			var sum float64
+			for k := range c.input {
+				sum += c.input[k][c.inputPosition+i]
+			}
+			c.mono = append(c.mono, sum/float64(len(c.input)))
+		}
+		period := c.findPitchPeriod(c.mono)
+
+		if speed > 1 {
+			c.skipPitchPeriod(speed, period)
+		} else {
+			c.insertPitchPeriod(speed, period)
+		}
+	}
+
+	// Remove the samples that were processed from the input buffer
+	for k := range c.input {
+		c.input[k] = append(c.input[k][:0], c.input[k][c.inputPosition:]...)
+	}
+	c.inputPosition = 0
+}
+
+// SetAnalysisHop sets the number of input samples that will be added to the
+// input buffer by the next call to Convert.
+func (c *speechConverter) SetAnalysisHop(analysisHop int) {
+	c.analysisHop = analysisHop
+}
+
+// Convert adds the first analysisHop samples of the analysis frame to the input
+// buffer, processes them, and returns the next synthesisHop samples of the
+// output buffer.
+func (c *speechConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	hop := c.analysisHop
+	if hop > analysisFrame.Len() {
+		hop = analysisFrame.Len()
+	}
+	for k := range c.input {
+		c.input[k] = append(c.input[k], analysisFrame[k][:hop]...)
+	}
+
+	if c.analysisHop > 0 {
+		c.changeSpeed(float64(c.analysisHop) / float64(c.synthesisHop))
+	}
+
+	// Wait for the output buffer to contain enough samples to absorb the
+	// irregularity of the processing before returning them.
+	if !c.started && len(c.output[0]) >= 2*c.maxPeriod+c.synthesisHop {
+		c.started = true
+	}
+	if !c.started || len(c.output[0]) < c.synthesisHop {
+		c.delay += c.synthesisHop
+		for k := range c.synthesisFrame {
+			for i := range c.synthesisFrame[k] {
+				c.synthesisFrame[k][i] = 0
+			}
+		}
+		return c.synthesisFrame
+	}
+
+	for k := range c.output {
+		copy(c.synthesisFrame[k], c.output[k])
+		c.output[k] = append(c.output[k][:0], c.output[k][c.synthesisHop:]...)
+	}
+
+	return c.synthesisFrame
+}
+
+// Clear clears the state of the Converter, making it ready to be used on
+// another signal (or another part of a signal). It is automatically called by
+// the Flush, Clear and New methods of the TSM object.
+func (c *speechConverter) Clear() {
+	for k := range c.input {
+		c.input[k] = c.input[k][:0]
+		c.output[k] = c.output[k][:0]
+	}
+	c.inputPosition = 0
+	c.remainingInputToCopy = 0
+	c.remainder = 0
+	c.started = false
+	c.delay = 0
+}
+
+// Delay returns the number of silent samples that were returned instead of the
+// output since the last call to Clear.
+func (c *speechConverter) Delay() int {
+	return c.delay
+}
+
+// Latency returns the number of silent samples that are returned before the
+// output when the speed ratio is 1. It is computed by simulating the filling
+// of the buffers, since the input is then copied to the output by blocks of
+// 2*maxPeriod samples.
+func (c *speechConverter) Latency() int {
+	required := 2 * c.maxPeriod
+	outputLimit := 2*required + c.synthesisHop
+
+	input, output, latency := 0, 0, 0
+	for {
+		input += c.synthesisHop
+		for input >= required && output < outputLimit {
+			input -= required
+			output += required
+		}
+		if output >= 2*c.maxPeriod+c.synthesisHop {
+			return latency
+		}
+		latency += c.synthesisHop
+	}
+}
+
+// New returns a TSM implementing the speech procedure.
+//
+// channels is the number of channels of the signal that the TSM will process.
+// minPeriod and maxPeriod are the bounds of the pitch periods that will be
+// detected, in samples (e.g. the sampling rate divided by 400Hz and by 65Hz).
+// The speed of the signal is changed by the ratio analysisHop/synthesisHop,
+// and synthesisHop is the number of samples that are written to the output
+// for each analysis frame.
+//
+// Since the converter waits for a few pitch periods to be processed before
+// returning them, the output starts with a short silence (see
+// tsm.DelayConverter), which is included in the latency of the TSM.
+func New(channels int, analysisHop int, synthesisHop int, minPeriod int, maxPeriod int) (*tsm.TSM, error) {
+	if minPeriod <= 0 || maxPeriod < minPeriod {
+		return nil, errors.Wrapf(tsm.ErrInvalidParameter, "the pitch periods should satisfy 0 < minPeriod <= maxPeriod, got %d and %d", minPeriod, maxPeriod)
+	}
+
+	bufferLength := maxSpeed * synthesisHop
+	if analysisHop > bufferLength {
+		bufferLength = analysisHop
+	} else if -analysisHop > bufferLength {
+		bufferLength = -analysisHop
+	}
+
+	converter := &speechConverter{
+		synthesisHop: synthesisHop,
+		minPeriod:    minPeriod,
+		maxPeriod:    maxPeriod,
+	}
+	settings := tsm.Settings{
+		Channels:     channels,
+		AnalysisHop:  analysisHop,
+		SynthesisHop: synthesisHop,
+		FrameLength:  synthesisHop,
+
+		DeltaAfter: bufferLength - synthesisHop,
+
+		Converter: converter,
+	}
+
+	// Validate the settings before allocating the buffers of the converter
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	converter.input = make([][]float64, channels)
+	converter.output = make([][]float64, channels)
+	converter.synthesisFrame = multichannel.NewTSMBuffer(channels, synthesisHop)
+
+	return tsm.New(settings)
+}
+
+// NewWithSpeed returns a TSM implementing the speech procedure, modifying the
+// speed of the input signal by the ratio speed.
+//
+// The arguments synthesisHop, minPeriod and maxPeriod may be strictly
+// negative, in which case they will be replaced by default values (the default
+// pitch periods correspond to a 65-400Hz range for a signal sampled at
+// 44.1kHz). A negative speed plays the signal backwards (see the SetHistory
+// method of tsm.TSM).
+//
+// Deprecated: use NewWithOptions, which does not rely on negative values.
+func NewWithSpeed(channels int, speed float64, synthesisHop int, minPeriod int, maxPeriod int) (*tsm.TSM, error) {
+	if synthesisHop < 0 {
+		synthesisHop = defaultSynthesisHop
+	}
+	if minPeriod < 0 {
+		minPeriod = defaultMinPeriod
+	}
+	if maxPeriod < 0 {
+		maxPeriod = defaultMaxPeriod
+	}
+
+	analysisHop := bufferHop(synthesisHop, speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, minPeriod, maxPeriod)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(speed)
+
+	return t, nil
+}
+
+// bufferHop returns the analysis hop corresponding to speed, rounded away from
+// zero so that New keeps enough samples for the fractional analysis hops used
+// after SetSpeed.
+func bufferHop(synthesisHop int, speed float64) int {
+	hop := math.Ceil(math.Abs(float64(synthesisHop) * speed))
+	if speed < 0 {
+		return -int(hop)
+	}
+	return int(hop)
+}
+
+// Default returns a TSM implementing the speech procedure with sane default
+// parameters.
+func Default(channels int, speed float64) (*tsm.TSM, error) {
+	return NewWithOptions(channels, tsm.WithSpeed(speed))
+}
+
+// NewWithOptions returns a TSM implementing the speech procedure, configured by
+// the options (see tsm.Config). Only the speed, the sample rate and the
+// synthesis hop are used. The pitch periods correspond to a 65-400Hz range.
+func NewWithOptions(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+	c := tsm.NewConfig(options...)
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	synthesisHop := c.Length(c.SynthesisHop, c.SynthesisHopDuration, c.Scale(defaultSynthesisHop))
+	analysisHop := bufferHop(synthesisHop, c.Speed)
+
+	t, err := New(channels, analysisHop, synthesisHop, c.Scale(defaultMinPeriod), c.Scale(defaultMaxPeriod))
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(c.Speed)
+
+	return t, nil
+}
+
+// Process changes the speed of a whole signal with the speech procedure,
+// configured by the options (see NewWithOptions), and returns the result.
+func Process(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error) {
+	t, err := NewWithOptions(input.Channels(), options...)
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Process(t, input)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package speech
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// periodic returns length samples of a signal with the given period.
+func periodic(period float64, length int) []float64 {
+	samples := make([]float64, length)
+	for i := range samples {
+		phase := 2 * math.Pi * float64(i) / period
+		samples[i] = math.Sin(phase) + 0.5*math.Sin(2*phase) + 0.25*math.Sin(3*phase)
+	}
+	return samples
+}
+
+type bestPeriodTest struct {
+	samples   []float64
+	minPeriod int
+	maxPeriod int
+
+	out int
+}
+
+var bestPeriodTests = []bestPeriodTest{
+	{periodic(7, 20), 3, 10, 7},
+	{periodic(7, 20), 8, 10, 8},
+	{periodic(4, 20), 3, 10, 4},
+	{make([]float64, 20), 3, 10, 3},
+}
+
+func TestBestPeriod(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range bestPeriodTests {
+		out := bestPeriod(c.samples, c.minPeriod, c.maxPeriod)
+		assert.Equal(c.out, out, fmt.Sprintf("bestPeriod (%d)", i))
+	}
+}
+
+func TestFindPitchPeriod(t *testing.T) {
+	assert := assert.New(t)
+
+	c := speechConverter{minPeriod: defaultMinPeriod, maxPeriod: defaultMaxPeriod}
+
+	for _, period := range []int{120, 250, 367, 500} {
+		out := c.findPitchPeriod(periodic(float64(period), 2*defaultMaxPeriod))
+		assert.Equal(period, out, fmt.Sprintf("findPitchPeriod (%d)", period))
+	}
+}
+
+func TestProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	c := speechConverter{minPeriod: defaultMinPeriod, maxPeriod: defaultMaxPeriod}
+
+	input := multichannel.TSMBuffer{periodic(294, 44100)}
+	for _, speed := range []float64{0.5, 0.8, 1, 1.5, 2, 3, 4} {
+		output, err := Process(input, tsm.WithSpeed(speed))
+		if !assert.NoError(err) {
+			continue
+		}
+
+		// The silence at the beginning of the output of the converter
+		// should be removed
+		expected := int(math.Floor(float64(input.Len())/speed + 0.5))
+		assert.Equal(expected, output.Len(), fmt.Sprintf("Process (speed %g)", speed))
+		if speed == 1 {
+			assert.InDeltaSlice(input[0], output[0], 0.000001, "Process (speed 1)")
+		}
+
+		// The pitch should not be modified
+		middle := output.Len() / 2
+		period := c.findPitchPeriod(output[0][middle : middle+2*defaultMaxPeriod])
+		assert.InDelta(294, period, 1, fmt.Sprintf("Process pitch (speed %g)", speed))
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(-1, 256, 256, defaultMinPeriod, defaultMaxPeriod)
+	assert.True(errors.Is(err, tsm.ErrInvalidChannels), "negative number of channels")
+
+	_, err = New(1, 256, 0, defaultMinPeriod, defaultMaxPeriod)
+	assert.True(errors.Is(err, tsm.ErrInvalidHop), "null synthesis hop")
+
+	_, err = New(1, 256, 256, defaultMaxPeriod, defaultMinPeriod)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter), "minPeriod larger than maxPeriod")
+}
@@ -0,0 +1,480 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package stft implements the short-time Fourier transform (STFT) of
+// multi-channel signals, and its inverse by overlap-add.
+//
+// The signals are processed in a streaming fashion, in the same way as the TSM
+// procedures of the tsm package: the samples are put in an Analyzer, which
+// returns the spectra of the frames as soon as they are complete, and the
+// spectra are added to a Synthesizer, from which the resynthesized samples are
+// received. The frames are centered on the multiples of the hop, the first one
+// being centered on the first sample of the signal.
+package stft
+
+import (
+	"github.com/Muges/go-tsm/internal/fft"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// The errors returned by Settings.Validate.
+var (
+	ErrInvalidChannels    = errors.New("invalid number of channels")
+	ErrInvalidFrameLength = errors.New("invalid frame length")
+	ErrInvalidHop         = errors.New("invalid hop")
+	ErrInvalidFFTSize     = errors.New("invalid FFT size")
+	ErrInvalidWindow      = errors.New("invalid window")
+)
+
+// Settings contains the parameters of a short-time Fourier transform.
+//
+// The signal is divided into frames of FrameLength samples, separated by Hop
+// samples. Each frame is multiplied by the AnalysisWindow, padded with zeros
+// to FFTSize samples, and its spectrum is computed. If FFTSize is 0, the next
+// length whose only prime factors are 2, 3 and 5 is used, for which the
+// transform is the fastest. When resynthesizing the signal, the frames computed from the
+// spectra are multiplied by the SynthesisWindow and overlapped, and the result
+// is divided by the sum of the products of the windows. A nil window is
+// equivalent to a rectangular one.
+type Settings struct {
+	Channels        int
+	FrameLength     int
+	Hop             int
+	FFTSize         int
+	AnalysisWindow  []float64
+	SynthesisWindow []float64
+}
+
+// NewSettings returns the Settings of a short-time Fourier transform with the
+// same window for the analysis and the synthesis.
+func NewSettings(channels int, frameLength int, hop int, w window.Func) Settings {
+	return Settings{
+		Channels:        channels,
+		FrameLength:     frameLength,
+		Hop:             hop,
+		AnalysisWindow:  w(frameLength),
+		SynthesisWindow: w(frameLength),
+	}
+}
+
+// Validate checks that the settings are valid, and returns an error describing
+// the first invalid field otherwise.
+func (s Settings) Validate() error {
+	if s.Channels <= 0 {
+		return errors.Wrapf(ErrInvalidChannels, "the number of channels should be strictly positive, got %d", s.Channels)
+	}
+	if s.FrameLength <= 0 {
+		return errors.Wrapf(ErrInvalidFrameLength, "the frame length should be strictly positive, got %d", s.FrameLength)
+	}
+	if s.Hop <= 0 || s.Hop > s.FrameLength {
+		return errors.Wrapf(ErrInvalidHop, "the hop should be in [1, %d], got %d", s.FrameLength, s.Hop)
+	}
+	if s.FFTSize != 0 && s.FFTSize < s.FrameLength {
+		return errors.Wrapf(ErrInvalidFFTSize, "the FFT size should not be lower than the frame length (%d), got %d", s.FrameLength, s.FFTSize)
+	}
+	if s.AnalysisWindow != nil && len(s.AnalysisWindow) != s.FrameLength {
+		return errors.Wrapf(ErrInvalidWindow, "the analysis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.AnalysisWindow))
+	}
+	if s.SynthesisWindow != nil && len(s.SynthesisWindow) != s.FrameLength {
+		return errors.Wrapf(ErrInvalidWindow, "the synthesis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.SynthesisWindow))
+	}
+	return nil
+}
+
+// TransformSize returns the size of the Fourier transforms, i.e. FFTSize or
+// its default value.
+func (s Settings) TransformSize() int {
+	if s.FFTSize > 0 {
+		return s.FFTSize
+	}
+	return fft.NextFastSize(s.FrameLength)
+}
+
+// A Frame contains the spectrum of each channel of a frame. Re[k][i] and
+// Im[k][i] are the real and imaginary parts of the bin i of the channel k, for
+// i in [0, Size/2], the other bins being deduced from them since the signal is
+// real. The frequency of the bin i is i*sampleRate/Size.
+type Frame struct {
+	Re   [][]float64
+	Im   [][]float64
+	Size int
+}
+
+// NewFrame returns a Frame filled with zeros, with the spectra of the given
+// size.
+func NewFrame(channels int, size int) Frame {
+	return Frame{
+		Re:   multichannel.NewTSMBuffer(channels, size/2+1),
+		Im:   multichannel.NewTSMBuffer(channels, size/2+1),
+		Size: size,
+	}
+}
+
+// Channels returns the number of channels of the frame.
+func (f Frame) Channels() int {
+	return len(f.Re)
+}
+
+// Bins returns the number of bins of the spectra (Size/2+1).
+func (f Frame) Bins() int {
+	return f.Size/2 + 1
+}
+
+// Magnitude returns the magnitude of the bin i of the channel k.
+func (f Frame) Magnitude(k int, i int) float64 {
+	return math.Hypot(f.Re[k][i], f.Im[k][i])
+}
+
+// Copy returns a copy of the frame.
+func (f Frame) Copy() Frame {
+	c := NewFrame(f.Channels(), f.Size)
+	for k := range f.Re {
+		copy(c.Re[k], f.Re[k])
+		copy(c.Im[k], f.Im[k])
+	}
+	return c
+}
+
+// An Analyzer computes the short-time Fourier transform of a signal.
+type Analyzer struct {
+	s Settings
+
+	inBuffer multichannel.CBuffer
+	frame    multichannel.TSMBuffer
+	plan     *fft.RealPlan
+	signal   []float64
+	spectrum Frame
+	flushing bool
+}
+
+// NewAnalyzer returns an Analyzer, or an error if the settings are invalid.
+func NewAnalyzer(s Settings) (*Analyzer, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	size := s.TransformSize()
+	a := &Analyzer{
+		s:        s,
+		inBuffer: multichannel.NewCBuffer(s.Channels, s.FrameLength),
+		frame:    multichannel.NewTSMBuffer(s.Channels, s.FrameLength),
+		plan:     fft.RealPlanFor(size),
+		signal:   make([]float64, size),
+		spectrum: NewFrame(s.Channels, size),
+	}
+	a.Clear()
+
+	return a, nil
+}
+
+// Clear clears the state of the Analyzer, making it ready to be used on
+// another signal.
+func (a *Analyzer) Clear() {
+	a.inBuffer.Remove(a.inBuffer.Len())
+
+	// Left pad the input with half a frame of zeros, so that the first frame
+	// is centered on the first sample.
+	a.inBuffer.SetReadable(a.s.FrameLength / 2)
+	a.flushing = false
+}
+
+// RemainingInputSpace returns the number of samples that can be put in the
+// Analyzer before reading the next frame.
+func (a *Analyzer) RemainingInputSpace() int {
+	return a.inBuffer.RemainingSpace()
+}
+
+// Put writes as many samples of the buffer as possible (see
+// RemainingInputSpace) in the Analyzer, and returns the number of samples that
+// were written. The frames should then be read with Next. An error wrapping
+// multichannel.ErrChannelMismatch is returned if the buffer does not have the
+// same number of channels as the Analyzer.
+func (a *Analyzer) Put(buffer multichannel.Buffer) (int, error) {
+	n, err := a.inBuffer.CheckedWrite(buffer)
+	if err != nil {
+		return 0, errors.Wrapf(err, "the buffer should have %d channels, got %d", a.s.Channels, buffer.Channels())
+	}
+	return n, nil
+}
+
+// Flush indicates that no more samples will be put in the Analyzer. The end
+// of the signal is padded with zeros, and Next returns the frames until the
+// last one containing samples of the signal. The Analyzer should then be
+// cleared before being used on another signal.
+func (a *Analyzer) Flush() {
+	a.flushing = true
+}
+
+// Next computes the spectrum of the next frame, and returns true, if all its
+// samples are available (or if the Analyzer is flushed and the frame contains
+// samples of the signal). Otherwise, it returns false, and more samples
+// should be put in the Analyzer.
+//
+// The returned Frame is only valid until the next call to Next, and should be
+// copied to be kept longer.
+func (a *Analyzer) Next() (Frame, bool) {
+	if a.inBuffer.Len() < a.s.FrameLength && !(a.flushing && a.inBuffer.Len() > 0) {
+		return Frame{}, false
+	}
+
+	a.inBuffer.PeekAt(a.frame, 0)
+	a.inBuffer.Remove(a.s.Hop)
+	if a.s.AnalysisWindow != nil {
+		a.frame.ApplyWindow(a.s.AnalysisWindow)
+	}
+
+	for k := range a.frame {
+		copy(a.signal, a.frame[k])
+		for i := a.s.FrameLength; i < len(a.signal); i++ {
+			a.signal[i] = 0
+		}
+		a.plan.Forward(a.signal, a.spectrum.Re[k], a.spectrum.Im[k])
+	}
+
+	return a.spectrum, true
+}
+
+// A Synthesizer resynthesizes a signal from its short-time Fourier transform.
+type Synthesizer struct {
+	s Settings
+
+	outBuffer         multichannel.CBuffer
+	normalizeBuffer   multichannel.NormalizeBuffer
+	normalizeWindow   []float64
+	skipOutputSamples int
+	flushed           bool
+
+	plan   *fft.RealPlan
+	signal []float64
+	frame  multichannel.TSMBuffer
+}
+
+// NewSynthesizer returns a Synthesizer, or an error if the settings are
+// invalid.
+func NewSynthesizer(s Settings) (*Synthesizer, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	normalizeWindow, err := window.Product(s.AnalysisWindow, s.SynthesisWindow)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create normalizeWindow")
+	}
+	if normalizeWindow == nil {
+		normalizeWindow = make([]float64, s.FrameLength)
+		for i := range normalizeWindow {
+			normalizeWindow[i] = 1
+		}
+	}
+
+	size := s.TransformSize()
+	synthesizer := &Synthesizer{
+		s: s,
+
+		outBuffer:       multichannel.NewCBuffer(s.Channels, s.FrameLength),
+		normalizeBuffer: multichannel.NewNormalizeBuffer(s.FrameLength),
+		normalizeWindow: normalizeWindow,
+
+		plan:   fft.RealPlanFor(size),
+		signal: make([]float64, size),
+		frame:  multichannel.NewTSMBuffer(s.Channels, s.FrameLength),
+	}
+	synthesizer.Clear()
+
+	return synthesizer, nil
+}
+
+// Clear clears the state of the Synthesizer, making it ready to be used on
+// another signal.
+func (s *Synthesizer) Clear() {
+	// Remove the readable samples and the partial sums of the last frames
+	s.outBuffer.SetReadable(s.outBuffer.RemainingSpace())
+	s.outBuffer.Remove(s.outBuffer.Len())
+	s.normalizeBuffer.Remove(s.s.FrameLength)
+
+	// The first frame is centered on the first sample, so its first half is
+	// ignored.
+	s.skipOutputSamples = s.s.FrameLength / 2
+	s.flushed = false
+}
+
+// Add adds the frame computed from the spectrum to the output. The output
+// samples that are complete (Hop samples) should then be received before
+// adding the next frame, otherwise an error wrapping
+// multichannel.ErrNotEnoughSpace is returned. An error wrapping
+// multichannel.ErrChannelMismatch or ErrInvalidFFTSize is returned if the
+// frame does not match the settings.
+func (s *Synthesizer) Add(frame Frame) error {
+	size := s.plan.Len()
+	if frame.Channels() != s.s.Channels {
+		return errors.Wrapf(multichannel.ErrChannelMismatch, "the frame should have %d channels, got %d", s.s.Channels, frame.Channels())
+	}
+	if frame.Size != size {
+		return errors.Wrapf(ErrInvalidFFTSize, "the frame should have a size of %d, got %d", size, frame.Size)
+	}
+	if s.outBuffer.RemainingSpace() < s.s.FrameLength {
+		return errors.Wrap(multichannel.ErrNotEnoughSpace, "the output should be received before adding a frame")
+	}
+
+	for k := range s.frame {
+		s.plan.Inverse(frame.Re[k], frame.Im[k], s.signal)
+		copy(s.frame[k], s.signal)
+	}
+	if s.s.SynthesisWindow != nil {
+		s.frame.ApplyWindow(s.s.SynthesisWindow)
+	}
+
+	// Overlap and add the frame, and normalize the samples that are complete
+	s.outBuffer.Add(s.frame)
+	s.normalizeBuffer.Add(s.normalizeWindow)
+	s.outBuffer.Divide(s.normalizeBuffer, s.s.Hop)
+	s.normalizeBuffer.Remove(s.s.Hop)
+	s.outBuffer.SetReadable(s.s.Hop)
+	s.skip()
+
+	return nil
+}
+
+// skip removes the output samples that should be ignored.
+func (s *Synthesizer) skip() {
+	n := s.skipOutputSamples
+	if n > s.outBuffer.Len() {
+		n = s.outBuffer.Len()
+	}
+	s.outBuffer.Remove(n)
+	s.skipOutputSamples -= n
+}
+
+// Receive reads as many complete output samples as possible, writes them to
+// the buffer, and returns the number of samples that were written. An error
+// wrapping multichannel.ErrChannelMismatch is returned if the buffer does not
+// have the same number of channels as the Synthesizer.
+func (s *Synthesizer) Receive(buffer multichannel.Buffer) (int, error) {
+	n, err := s.outBuffer.CheckedRead(buffer)
+	if err != nil {
+		return 0, errors.Wrapf(err, "the buffer should have %d channels, got %d", s.s.Channels, buffer.Channels())
+	}
+	return n, nil
+}
+
+// Flush indicates that no more frames will be added, so that the samples of
+// the last frames are completed, and writes as many output samples as
+// possible to the buffer, as Receive does. It returns 0 once all the samples
+// have been received, and the Synthesizer should then be cleared before being
+// used on another signal.
+func (s *Synthesizer) Flush(buffer multichannel.Buffer) (int, error) {
+	if !s.flushed {
+		n, err := s.Receive(buffer)
+		if err != nil || n > 0 {
+			return n, err
+		}
+
+		length := s.s.FrameLength - s.s.Hop
+		s.outBuffer.Divide(s.normalizeBuffer, length)
+		s.normalizeBuffer.Remove(length)
+		s.outBuffer.SetReadable(length)
+		s.skip()
+		s.flushed = true
+	}
+
+	return s.Receive(buffer)
+}
+
+// Analyze computes the short-time Fourier transform of a whole signal.
+func Analyze(s Settings, input multichannel.Buffer) ([]Frame, error) {
+	a, err := NewAnalyzer(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []Frame
+	next := func() {
+		for {
+			frame, ok := a.Next()
+			if !ok {
+				return
+			}
+			frames = append(frames, frame.Copy())
+		}
+	}
+
+	for in := 0; in < input.Len(); {
+		end := in + a.RemainingInputSpace()
+		if end > input.Len() {
+			end = input.Len()
+		}
+		n, err := a.Put(input.Slice(in, end))
+		if err != nil {
+			return nil, err
+		}
+		in += n
+		next()
+	}
+	a.Flush()
+	next()
+
+	return frames, nil
+}
+
+// Synthesize resynthesizes a signal of the given length from its short-time
+// Fourier transform (as returned by Analyze). The output is padded with zeros
+// if the frames do not cover the whole length.
+func Synthesize(s Settings, frames []Frame, length int) (multichannel.TSMBuffer, error) {
+	synthesizer, err := NewSynthesizer(s)
+	if err != nil {
+		return nil, err
+	}
+
+	output := multichannel.NewTSMBuffer(s.Channels, length)
+	position := 0
+	receive := func(receive func(buffer multichannel.Buffer) (int, error)) error {
+		for position < length {
+			n, err := receive(output.Slice(position, length))
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			position += n
+		}
+		return nil
+	}
+
+	for _, frame := range frames {
+		if position >= length {
+			return output, nil
+		}
+		if err := synthesizer.Add(frame); err != nil {
+			return nil, err
+		}
+		if err := receive(synthesizer.Receive); err != nil {
+			return nil, err
+		}
+	}
+	if err := receive(synthesizer.Flush); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
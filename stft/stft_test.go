@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package stft_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/stft"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// signal returns a sum of sines of the given length.
+func signal(channels int, length int) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(channels, length)
+	for k := range buffer {
+		for i := range buffer[k] {
+			buffer[k][i] = math.Sin(0.05*float64(i+k)) + 0.5*math.Sin(1.3*float64(i))
+		}
+	}
+	return buffer
+}
+
+type validateTest struct {
+	settings stft.Settings
+	err      error
+}
+
+var validateTests = []validateTest{
+	{stft.NewSettings(2, 256, 64, window.Hanning), nil},
+	{stft.Settings{Channels: 1, FrameLength: 100, Hop: 100}, nil},
+	{stft.Settings{Channels: 1, FrameLength: 100, Hop: 50, FFTSize: 512}, nil},
+
+	{stft.Settings{Channels: 0, FrameLength: 256, Hop: 64}, stft.ErrInvalidChannels},
+	{stft.Settings{Channels: 1, FrameLength: 0, Hop: 64}, stft.ErrInvalidFrameLength},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 0}, stft.ErrInvalidHop},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 512}, stft.ErrInvalidHop},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 64, FFTSize: 128}, stft.ErrInvalidFFTSize},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 64, FFTSize: 300}, nil},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 64, AnalysisWindow: window.Hanning(128)}, stft.ErrInvalidWindow},
+	{stft.Settings{Channels: 1, FrameLength: 256, Hop: 64, SynthesisWindow: window.Hanning(128)}, stft.ErrInvalidWindow},
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range validateTests {
+		err := c.settings.Validate()
+		if c.err == nil {
+			assert.NoError(err, fmt.Sprintf("Validate (%d)", i))
+		} else {
+			assert.True(errors.Is(err, c.err), fmt.Sprintf("Validate (%d): %v", i, err))
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	assert := assert.New(t)
+
+	s := stft.NewSettings(1, 256, 64, window.Hanning)
+	for _, length := range []int{0, 1, 64, 1000} {
+		frames, err := stft.Analyze(s, signal(1, length))
+		if assert.NoError(err) {
+			// The frames start every 64 samples, the first one 128 samples
+			// before the signal, and the last one before its end.
+			assert.Equal((length+128+63)/64, len(frames), fmt.Sprintf("Analyze (length %d)", length))
+		}
+	}
+
+	// The spectrum of a sine should peak at its frequency
+	input := multichannel.NewTSMBuffer(1, 4096)
+	for i := range input[0] {
+		input[0][i] = math.Sin(2 * math.Pi * float64(i) / 16)
+	}
+	frames, err := stft.Analyze(s, input)
+	if assert.NoError(err) {
+		frame := frames[len(frames)/2]
+		assert.Equal(129, frame.Bins())
+
+		peak := 0
+		for i := 0; i < frame.Bins(); i++ {
+			if frame.Magnitude(0, i) > frame.Magnitude(0, peak) {
+				peak = i
+			}
+		}
+		assert.Equal(256/16, peak)
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []stft.Settings{
+		stft.NewSettings(2, 256, 64, window.Hanning),
+		stft.NewSettings(2, 256, 128, window.SqrtHanning),
+		{Channels: 2, FrameLength: 100, Hop: 100},
+		{Channels: 2, FrameLength: 100, Hop: 30, FFTSize: 512, AnalysisWindow: window.Hanning(100)},
+	} {
+		for _, length := range []int{0, 1, 100, 1000} {
+			input := signal(2, length)
+			frames, err := stft.Analyze(s, input)
+			if !assert.NoError(err) {
+				continue
+			}
+
+			output, err := stft.Synthesize(s, frames, length)
+			if assert.NoError(err) {
+				for k := range input {
+					assert.InDeltaSlice(input[k], output[k], 1e-9, fmt.Sprintf("Synthesize (frame length %d, hop %d, length %d)", s.FrameLength, s.Hop, length))
+				}
+			}
+		}
+	}
+}
+
+func TestSynthesizerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	s := stft.NewSettings(2, 256, 64, window.Hanning)
+	synthesizer, err := stft.NewSynthesizer(s)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.True(errors.Is(synthesizer.Add(stft.NewFrame(1, 256)), multichannel.ErrChannelMismatch))
+	assert.True(errors.Is(synthesizer.Add(stft.NewFrame(2, 512)), stft.ErrInvalidFFTSize))
+
+	// The first frames are only used to complete the first half frame
+	assert.NoError(synthesizer.Add(stft.NewFrame(2, 256)))
+	assert.NoError(synthesizer.Add(stft.NewFrame(2, 256)))
+	assert.NoError(synthesizer.Add(stft.NewFrame(2, 256)))
+	assert.True(errors.Is(synthesizer.Add(stft.NewFrame(2, 256)), multichannel.ErrNotEnoughSpace))
+}
@@ -32,7 +32,14 @@ import (
 type TSMStreamer struct {
 	t             *tsm.TSM
 	inputStreamer beep.Streamer
-	buffer        StereoBuffer
+	state         *state
+}
+
+// state contains the mutable state of a TSMStreamer, which is shared by its
+// copies.
+type state struct {
+	buffer StereoBuffer
+	err    error
 }
 
 // New creates a new TSMSTreamer, which changes the speed of the inputStreamer
@@ -41,28 +48,45 @@ func New(t *tsm.TSM, inputStreamer beep.Streamer) TSMStreamer {
 	return TSMStreamer{
 		t:             t,
 		inputStreamer: inputStreamer,
+		state:         &state{},
 	}
 }
 
 // Stream copies at most len(samples) next audio samples to the samples slice.
+//
+// If the TSM procedure fails (e.g. because it does not process stereo
+// signals), Stream stops streaming, and the error is returned by Err.
 func (s TSMStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.state.err != nil {
+		return 0, false
+	}
+
 	length := 0
 
 	for length < len(samples) {
 		// Read samples from input stream and transfer them to TSM
 		nmax := s.t.RemainingInputSpace()
-		if len(s.buffer) < nmax {
+		if len(s.state.buffer) < nmax {
 			// This should only happen once
-			s.buffer = make([][2]float64, nmax)
+			s.state.buffer = make([][2]float64, nmax)
+		}
+		n, ok := s.inputStreamer.Stream(s.state.buffer[:nmax])
+		if _, s.state.err = s.t.Put(s.state.buffer[:n]); s.state.err != nil {
+			return length, false
 		}
-		n, ok := s.inputStreamer.Stream(s.buffer[:nmax])
-		s.t.Put(s.buffer[:n])
 
-		l := s.t.Receive(StereoBuffer(samples[length:]))
+		l, err := s.t.Receive(StereoBuffer(samples[length:]))
+		if err != nil {
+			s.state.err = err
+			return length, false
+		}
 		length += l
 
 		if l == 0 && !ok {
-			l = s.t.Flush(StereoBuffer(samples[length:]))
+			l, s.state.err = s.t.Flush(StereoBuffer(samples[length:]))
+			if s.state.err != nil {
+				return length, false
+			}
 			length += l
 
 			if l == 0 {
@@ -74,7 +98,11 @@ func (s TSMStreamer) Stream(samples [][2]float64) (n int, ok bool) {
 	return length, true
 }
 
-// Err propagates the wrapped Streamer's errors.
+// Err propagates the wrapped Streamer's errors, and returns the errors of the
+// TSM procedure.
 func (s TSMStreamer) Err() error {
+	if s.state.err != nil {
+		return s.state.err
+	}
 	return s.inputStreamer.Err()
 }
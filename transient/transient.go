@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package transient implements an energy-based transient detector, and a
+// tsm.SpeedController using it to preserve the transients of a signal.
+//
+// When the speed of a signal containing sharp attacks (e.g. drums) is reduced,
+// each attack appears in several overlapping analysis frames, at positions
+// which are different in each synthesis frame. As a result, the attacks are
+// repeated or smeared in the output. The Controller of this package avoids it
+// by using a speed ratio of 1 for the frames containing a transient, so that
+// the attack is at the same position in all the synthesis frames, and by
+// compensating the resulting change of duration on the following frames. Since
+// the compensation comes after the transient, it is written to the output a
+// little earlier than it would be at the target speed (by less than the length
+// of an analysis frame).
+//
+// Phase vocoder based methods would also need to reset the phases of the
+// frequencies at the onsets. Since the TSM methods of this module all work in
+// the time domain, and the spectral converters and the freezer of the tsm
+// package do not propagate phases from one input frame to the next, this is
+// not implemented.
+package transient
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+)
+
+// A Detector is an energy-based transient detector.
+//
+// It divides the frames into blocks of BlockLength samples, and computes the
+// energy of the first-order difference of each block, which emphasizes the
+// sharp variations of the signal. A block contains a transient if its energy
+// is larger than Threshold times the mean energy of the Context blocks
+// preceding it, and larger than MinEnergy.
+//
+// The first block of each frame is only used as context, so the frames should
+// be at least a few times longer than BlockLength.
+type Detector struct {
+	BlockLength int
+	Context     int
+	Threshold   float64
+	MinEnergy   float64
+
+	energies []float64
+}
+
+// NewDetector returns a Detector with default parameters.
+func NewDetector() *Detector {
+	return &Detector{
+		BlockLength: 128,
+		Context:     8,
+		Threshold:   5,
+		MinEnergy:   1e-6,
+	}
+}
+
+// blockEnergies computes the mean energy of the first-order difference of each
+// block of frame, and stores them in d.energies.
+func (d *Detector) blockEnergies(frame multichannel.TSMBuffer) {
+	d.energies = d.energies[:0]
+	if d.BlockLength <= 0 {
+		return
+	}
+
+	for start := 1; start < frame.Len(); start += d.BlockLength {
+		end := start + d.BlockLength
+		if end > frame.Len() {
+			end = frame.Len()
+		}
+
+		var energy float64
+		for k := range frame {
+			for i := start; i < end; i++ {
+				diff := frame[k][i] - frame[k][i-1]
+				energy += diff * diff
+			}
+		}
+		d.energies = append(d.energies, energy/float64(frame.Channels()*(end-start)))
+	}
+}
+
+// ContainsTransient returns true if the frame contains a transient.
+func (d *Detector) ContainsTransient(frame multichannel.TSMBuffer) bool {
+	d.blockEnergies(frame)
+
+	for i := 1; i < len(d.energies); i++ {
+		if d.energies[i] <= d.MinEnergy {
+			continue
+		}
+
+		from := i - d.Context
+		if from < 0 {
+			from = 0
+		}
+
+		var context float64
+		for _, e := range d.energies[from:i] {
+			context += e
+		}
+		context /= float64(i - from)
+
+		if d.energies[i] > d.Threshold*context {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Controller is a tsm.SpeedController which changes the speed of a TSM
+// while preserving the transients of the signal.
+//
+// The frames containing a transient are processed with a speed ratio of 1. The
+// difference between the input samples consumed by these frames and the ones
+// that would have been consumed at the target speed is compensated on the
+// following frames, by changing their speed by at most MaxCorrection times
+// the target speed.
+type Controller struct {
+	*Detector
+
+	Speed         float64
+	MaxCorrection float64
+
+	// excess is the number of input samples (in units of the synthesis hop)
+	// that were consumed in excess compared to the target speed.
+	excess float64
+}
+
+// NewController returns a new Controller changing the speed of the signal by
+// the ratio speed, using a Detector with default parameters.
+func NewController(speed float64) *Controller {
+	return &Controller{
+		Detector:      NewDetector(),
+		Speed:         speed,
+		MaxCorrection: 0.5,
+	}
+}
+
+// FrameSpeed returns the speed that should be used for the analysis frame.
+func (c *Controller) FrameSpeed(analysisFrame multichannel.TSMBuffer) (float64, bool) {
+	if c.Speed != 1 && c.ContainsTransient(analysisFrame) {
+		c.excess += 1 - c.Speed
+		return 1, false
+	}
+
+	maxCorrection := c.MaxCorrection * c.Speed
+	correction := c.excess
+	if correction > maxCorrection {
+		correction = maxCorrection
+	} else if correction < -maxCorrection {
+		correction = -maxCorrection
+	}
+	c.excess -= correction
+
+	return c.Speed - correction, false
+}
+
+// Clear clears the state of the Controller, making it ready to be used on
+// another signal (or another part of a signal). It is automatically called by
+// the Flush and Clear methods of the TSM object.
+func (c *Controller) Clear() {
+	c.excess = 0
+}
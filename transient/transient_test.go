@@ -0,0 +1,178 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package transient_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/quality"
+	"github.com/Muges/go-tsm/transient"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// frame returns a mono buffer containing a sine wave, with a click at the
+// given position if it is positive.
+func frame(amplitude float64, period float64, click int) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(1, 2048)
+	for i := range buffer[0] {
+		buffer[0][i] = amplitude * math.Sin(2*math.Pi*float64(i)/period)
+	}
+	if click >= 0 {
+		for i := 0; i < 64; i++ {
+			buffer[0][click+i] += 0.8 * math.Pow(-0.9, float64(i))
+		}
+	}
+	return buffer
+}
+
+// chord returns a chord with a click every 11025 samples, starting at the
+// sample 5000.
+func chord(length int) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(1, length)
+	for i := range buffer[0] {
+		buffer[0][i] = 0.3*math.Sin(2*math.Pi*440*float64(i)/44100) + 0.2*math.Sin(2*math.Pi*660*float64(i)/44100)
+
+		j := (i + 11025 - 5000) % 11025
+		if j < 50 {
+			buffer[0][i] += 0.5 * (1 - float64(j)/50)
+		}
+	}
+	return buffer
+}
+
+func TestDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	d := transient.NewDetector()
+
+	cases := []struct {
+		frame     multichannel.TSMBuffer
+		transient bool
+	}{
+		{frame(0, 100, -1), false},
+		{frame(0.5, 100, -1), false},
+		{frame(0.5, 441, -1), false},
+		{frame(0.5, 20, -1), false},
+		{frame(0, 100, 1000), true},
+		{frame(0.2, 441, 1000), true},
+		{frame(0.2, 441, 10), false},
+	}
+
+	for i, c := range cases {
+		assert.Equal(c.transient, d.ContainsTransient(c.frame), fmt.Sprintf("ContainsTransient (%d)", i))
+	}
+}
+
+func TestController(t *testing.T) {
+	assert := assert.New(t)
+
+	c := transient.NewController(0.5)
+
+	frames := []struct {
+		frame multichannel.TSMBuffer
+		speed float64
+	}{
+		{frame(0.2, 441, -1), 0.5},
+		{frame(0.2, 441, 1000), 1},
+		{frame(0.2, 441, 1000), 1},
+		{frame(0.2, 441, -1), 0.25},
+		{frame(0.2, 441, -1), 0.25},
+		{frame(0.2, 441, -1), 0.25},
+		{frame(0.2, 441, -1), 0.25},
+		{frame(0.2, 441, -1), 0.5},
+	}
+
+	for i, f := range frames {
+		speed, drop := c.FrameSpeed(f.frame)
+		assert.InDelta(f.speed, speed, 0.000001, fmt.Sprintf("FrameSpeed (%d)", i))
+		assert.False(drop, fmt.Sprintf("FrameSpeed (%d)", i))
+	}
+}
+
+func TestControllerClear(t *testing.T) {
+	assert := assert.New(t)
+
+	c := transient.NewController(0.5)
+	c.FrameSpeed(frame(0.2, 441, 1000))
+	c.FrameSpeed(frame(0.2, 441, 1000))
+
+	// The excess of consumed samples is not compensated after Clear
+	c.Clear()
+	speed, _ := c.FrameSpeed(frame(0.2, 441, -1))
+	assert.InDelta(0.5, speed, 0.000001)
+}
+
+// attacks returns the number of samples of the first channel of buffer which
+// are larger than the previous one by more than 0.1, which only happens at
+// the start of the clicks of chord.
+func attacks(buffer multichannel.TSMBuffer) int {
+	n := 0
+	for i := 1; i < buffer.Len(); i++ {
+		if buffer[0][i]-buffer[0][i-1] > 0.1 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestControllerProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	// The controller processes the frames containing a click before it is
+	// written to the output, so the clicks are written up to a frame early,
+	// which is taken into account by using longer frames to measure them
+	settings := quality.Settings{FrameLength: 2048, Hop: 128, DynamicRange: 80}
+
+	reference := chord(44100)
+	for _, speed := range []float64{0.5, 0.7} {
+		// Without the controller, WSOLA repeats the clicks
+		output, err := wsola.Process(reference, tsm.WithSpeed(speed))
+		if !assert.NoError(err) {
+			continue
+		}
+		report, err := quality.MeasureWithSettings(reference, output, speed, settings)
+		if assert.NoError(err) {
+			assert.True(report.TransientDoubling > 0, fmt.Sprintf("without controller (speed %g)", speed))
+		}
+		assert.True(attacks(output) > attacks(reference), fmt.Sprintf("without controller (speed %g)", speed))
+
+		// With it, they are preserved, and the duration is unchanged
+		s, err := wsola.NewWithOptions(1, tsm.WithSpeed(speed))
+		if !assert.NoError(err) {
+			continue
+		}
+		s.SetSpeedController(transient.NewController(speed))
+		output, err = tsm.Process(s, reference)
+		if !assert.NoError(err) {
+			continue
+		}
+		report, err = quality.MeasureWithSettings(reference, output, speed, settings)
+		if assert.NoError(err) {
+			assert.Equal(0.0, report.TransientDoubling, fmt.Sprintf("with controller (speed %g)", speed))
+			assert.Equal(0, report.DurationError, fmt.Sprintf("with controller (speed %g)", speed))
+		}
+		assert.Equal(attacks(reference), attacks(output), fmt.Sprintf("with controller (speed %g)", speed))
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+)
+
+// chain is a Converter applying several Converters one after the other.
+type chain []Converter
+
+// Chain returns a Converter which applies the converters in order, each one
+// converting the frame returned by the previous one. It can be used for
+// example to apply effects (such as the ones created by NewSpectralConverter)
+// to the synthesis frames of a TSM method, either in its Settings or with
+// TSM.SetEffect. The converters should not be nil.
+//
+// The Converter returned by Chain is also a HopConverter, which sets the
+// analysis hop of the converters implementing HopConverter, and a
+// DelayConverter and a LatencyConverter, whose delay and latency are the sums
+// of the ones of the converters implementing these interfaces.
+func Chain(converters ...Converter) Converter {
+	return chain(append([]Converter(nil), converters...))
+}
+
+// Convert converts an analysis frame into a synthesis frame with each of the
+// converters of the chain.
+func (c chain) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	frame := analysisFrame
+	for _, converter := range c {
+		frame = converter.Convert(frame)
+	}
+	return frame
+}
+
+// Clear clears the state of all the converters of the chain.
+func (c chain) Clear() {
+	for _, converter := range c {
+		converter.Clear()
+	}
+}
+
+// SetAnalysisHop sets the analysis hop of the converters of the chain which
+// implement HopConverter.
+func (c chain) SetAnalysisHop(analysisHop int) {
+	for _, converter := range c {
+		if converter, ok := converter.(HopConverter); ok {
+			converter.SetAnalysisHop(analysisHop)
+		}
+	}
+}
+
+// Delay returns the sum of the delays of the converters of the chain which
+// implement DelayConverter.
+func (c chain) Delay() int {
+	delay := 0
+	for _, converter := range c {
+		if converter, ok := converter.(DelayConverter); ok {
+			delay += converter.Delay()
+		}
+	}
+	return delay
+}
+
+// Latency returns the sum of the latencies of the converters of the chain
+// which implement LatencyConverter.
+func (c chain) Latency() int {
+	latency := 0
+	for _, converter := range c {
+		if converter, ok := converter.(LatencyConverter); ok {
+			latency += converter.Latency()
+		}
+	}
+	return latency
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+)
+
+// A COLAReport describes how well the windows of a Settings satisfy the
+// constant overlap-add (COLA) condition, i.e. how flat the sum of the
+// overlapping normalize windows (the products of the analysis and synthesis
+// windows) is.
+//
+// The TSM divides its output by this sum, so that the amplitude of the signal
+// is preserved even if it is not flat. However, when the converter modifies
+// the frames, a large Ripple results in an amplitude modulation of the output
+// signal, and a small Min amplifies the artifacts. Moreover, the samples for
+// which the sum is lower than multichannel.NormalizeThreshold are not
+// normalized at all, which usually results in gaps in the output.
+//
+// If both windows are nil, the frames are added without being weighted, and
+// the TSM does not normalize its output. Sum is then the gain applied to the
+// signal, which should be 1 (i.e. the FrameLength should be equal to the
+// SynthesisHop).
+type COLAReport struct {
+	// Sum is the sum of the overlapping normalize windows in the steady
+	// state. It is periodic, and contains SynthesisHop values.
+	Sum []float64
+
+	Min  float64
+	Max  float64
+	Mean float64
+
+	// Ripple is the peak-to-peak variation of Sum, relative to its mean.
+	Ripple float64
+
+	// Gaps is the number of values of Sum that are lower than
+	// multichannel.NormalizeThreshold.
+	Gaps int
+}
+
+// IsCOLA returns true if the sum of the windows has no gaps and a ripple lower
+// than tolerance.
+func (r COLAReport) IsCOLA(tolerance float64) bool {
+	return r.Gaps == 0 && r.Ripple <= tolerance
+}
+
+// CheckCOLA computes the COLAReport of the windows of the settings s.
+func CheckCOLA(s Settings) (COLAReport, error) {
+	if s.SynthesisHop <= 0 {
+		return COLAReport{}, errors.Wrapf(ErrInvalidHop, "the synthesis hop should be strictly positive, got %d", s.SynthesisHop)
+	}
+	if s.AnalysisWindow != nil && len(s.AnalysisWindow) != s.FrameLength {
+		return COLAReport{}, errors.Wrapf(ErrInvalidWindow, "the analysis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.AnalysisWindow))
+	}
+	if s.SynthesisWindow != nil && len(s.SynthesisWindow) != s.FrameLength {
+		return COLAReport{}, errors.Wrapf(ErrInvalidWindow, "the synthesis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.SynthesisWindow))
+	}
+
+	normalizeWindow, err := window.Product(s.AnalysisWindow, s.SynthesisWindow)
+	if err != nil {
+		return COLAReport{}, errors.Wrap(err, "unable to create normalizeWindow")
+	}
+	if normalizeWindow == nil {
+		normalizeWindow = make([]float64, s.FrameLength)
+		for i := range normalizeWindow {
+			normalizeWindow[i] = 1
+		}
+	}
+
+	r := COLAReport{
+		Sum: make([]float64, s.SynthesisHop),
+	}
+	for i, v := range normalizeWindow {
+		r.Sum[i%s.SynthesisHop] += v
+	}
+
+	r.Min = r.Sum[0]
+	r.Max = r.Sum[0]
+	for _, v := range r.Sum {
+		if v < r.Min {
+			r.Min = v
+		}
+		if v > r.Max {
+			r.Max = v
+		}
+		if v < multichannel.NormalizeThreshold && v > -multichannel.NormalizeThreshold {
+			r.Gaps++
+		}
+		r.Mean += v
+	}
+	r.Mean /= float64(len(r.Sum))
+
+	if r.Mean != 0 {
+		r.Ripple = (r.Max - r.Min) / r.Mean
+	}
+
+	return r, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type colaTest struct {
+	settings tsm.Settings
+
+	err    bool
+	min    float64
+	max    float64
+	ripple float64
+	gaps   int
+}
+
+var colaTests = []colaTest{
+	// OLA
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256, SynthesisWindow: window.Hanning(256)}, false, 1, 1, 0, 0},
+	{tsm.Settings{SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256)}, false, 2, 2, 0, 0},
+	{tsm.Settings{SynthesisHop: 100, FrameLength: 256, SynthesisWindow: window.Hanning(256)}, false, 1.227, 1.337, 0.086, 0},
+
+	// Hanning analysis and synthesis windows
+	{tsm.Settings{SynthesisHop: 64, FrameLength: 256, AnalysisWindow: window.Hanning(256), SynthesisWindow: window.Hanning(256)}, false, 1.5, 1.5, 0, 0},
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256, AnalysisWindow: window.Hanning(256), SynthesisWindow: window.Hanning(256)}, false, 0.5, 1, 0.667, 0},
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256, AnalysisWindow: window.SqrtHanning(256), SynthesisWindow: window.SqrtHanning(256)}, false, 1, 1, 0, 0},
+
+	// No windows
+	{tsm.Settings{SynthesisHop: 256, FrameLength: 256}, false, 1, 1, 0, 0},
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256}, false, 2, 2, 0, 0},
+
+	// Gaps
+	{tsm.Settings{SynthesisHop: 256, FrameLength: 256, SynthesisWindow: window.Hanning(256)}, false, 0, 1, 2, 1},
+	{tsm.Settings{SynthesisHop: 512, FrameLength: 256, SynthesisWindow: window.Hanning(256)}, false, 0, 1, 4, 257},
+
+	// Invalid settings
+	{tsm.Settings{SynthesisHop: 0, FrameLength: 256}, true, 0, 0, 0, 0},
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256, SynthesisWindow: window.Hanning(128)}, true, 0, 0, 0, 0},
+	{tsm.Settings{SynthesisHop: 128, FrameLength: 256, AnalysisWindow: window.Hanning(128)}, true, 0, 0, 0, 0},
+}
+
+func TestCheckCOLA(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range colaTests {
+		r, err := tsm.CheckCOLA(c.settings)
+		if c.err {
+			assert.Error(err, fmt.Sprintf("CheckCOLA (%d)", i))
+			continue
+		}
+
+		if assert.NoError(err, fmt.Sprintf("CheckCOLA (%d)", i)) {
+			assert.Len(r.Sum, c.settings.SynthesisHop, fmt.Sprintf("CheckCOLA (%d)", i))
+			assert.InDelta(c.min, r.Min, 0.001, fmt.Sprintf("CheckCOLA (%d)", i))
+			assert.InDelta(c.max, r.Max, 0.001, fmt.Sprintf("CheckCOLA (%d)", i))
+			assert.InDelta(c.ripple, r.Ripple, 0.001, fmt.Sprintf("CheckCOLA (%d)", i))
+			assert.Equal(c.gaps, r.Gaps, fmt.Sprintf("CheckCOLA (%d)", i))
+			assert.Equal(c.gaps == 0 && c.ripple < 0.01, r.IsCOLA(0.01), fmt.Sprintf("CheckCOLA (%d)", i))
+		}
+	}
+}
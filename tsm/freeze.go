@@ -0,0 +1,247 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/internal/fft"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/window"
+	"math"
+)
+
+// A freezer generates a stationary signal from a single analysis frame, which
+// is used to sustain the sound indefinitely when the TSM is frozen.
+//
+// It computes the spectrum of the frame, and estimates the instantaneous
+// frequency of each of its bins. It then resynthesizes the signal with a phase
+// vocoder, keeping the magnitudes constant and advancing the phase of each bin
+// according to its instantaneous frequency, which gives a smoother sound than
+// repeating the same samples over and over.
+type freezer struct {
+	fftSize int
+	hop     int
+
+	analysisWindow   []float64
+	derivativeWindow []float64
+	synthesisWindow  []float64
+	normalizeWindow  []float64
+
+	// The magnitudes, phases and instantaneous frequencies (in radians per
+	// sample) of the bins of the spectrum of each channel.
+	magnitudes  [][]float64
+	phases      [][]float64
+	frequencies [][]float64
+
+	// overlap contains the sum of the synthesis frames that have already been
+	// generated, and output contains the generated samples that have not been
+	// read yet.
+	overlap [][]float64
+	output  [][]float64
+
+	plan   *fft.RealPlan
+	signal []float64
+	re     []float64
+	im     []float64
+	dre    []float64
+	dim    []float64
+	frame  multichannel.TSMBuffer
+}
+
+// newFreezer creates a new freezer for analysis frames of the given length.
+func newFreezer(channels int, length int) *freezer {
+	fftSize := 4
+	for 2*fftSize <= length {
+		fftSize *= 2
+	}
+	hop := fftSize / 4
+
+	f := &freezer{
+		fftSize: fftSize,
+		hop:     hop,
+
+		analysisWindow:   window.Hanning(fftSize),
+		derivativeWindow: make([]float64, fftSize),
+		synthesisWindow:  window.Hanning(fftSize),
+		normalizeWindow:  make([]float64, hop),
+
+		magnitudes:  make([][]float64, channels),
+		phases:      make([][]float64, channels),
+		frequencies: make([][]float64, channels),
+		overlap:     make([][]float64, channels),
+		output:      make([][]float64, channels),
+
+		plan:   fft.RealPlanFor(fftSize),
+		signal: make([]float64, fftSize),
+		re:     make([]float64, fftSize/2+1),
+		im:     make([]float64, fftSize/2+1),
+		dre:    make([]float64, fftSize/2+1),
+		dim:    make([]float64, fftSize/2+1),
+	}
+
+	f.frame = multichannel.NewTSMBuffer(channels, length)
+
+	// Derivative of the Hanning window, used to estimate the instantaneous
+	// frequencies
+	freq := 2 * math.Pi / float64(fftSize)
+	for i := range f.derivativeWindow {
+		f.derivativeWindow[i] = 0.5 * freq * math.Sin(freq*float64(i))
+	}
+
+	for i := 0; i < fftSize; i++ {
+		f.normalizeWindow[i%hop] += f.analysisWindow[i] * f.synthesisWindow[i]
+	}
+
+	for k := 0; k < channels; k++ {
+		f.magnitudes[k] = make([]float64, fftSize/2+1)
+		f.phases[k] = make([]float64, fftSize/2+1)
+		f.frequencies[k] = make([]float64, fftSize/2+1)
+		f.overlap[k] = make([]float64, fftSize)
+	}
+
+	return f
+}
+
+// analyze computes the spectrum of the middle of the frame, from which the
+// stationary signal will be generated, and discards the samples that were
+// generated from the previous frame.
+//
+// The generated signal is aligned with the frame, i.e. its first samples are
+// as close as possible to the first samples of the frame, so that the
+// transition between the input signal and the generated one is smooth.
+func (f *freezer) analyze(frame multichannel.TSMBuffer) {
+	offset := (frame.Len() - f.fftSize) / 2
+
+	// The first output sample corresponds to the beginning of the last
+	// synthesis frame generated below to prime the overlap buffer, i.e. to the
+	// sample offset+fftSize-hop of the frame. The phases are shifted so that
+	// it corresponds to the first sample of the frame instead.
+	shift := float64(offset + f.fftSize - f.hop)
+
+	for k := range frame {
+		for i := 0; i < f.fftSize; i++ {
+			var v float64
+			if offset+i >= 0 && offset+i < frame.Len() {
+				v = frame[k][offset+i]
+			}
+			f.signal[i] = v * f.analysisWindow[i]
+		}
+		f.plan.Forward(f.signal, f.re, f.im)
+
+		for i := 0; i < f.fftSize; i++ {
+			var v float64
+			if offset+i >= 0 && offset+i < frame.Len() {
+				v = frame[k][offset+i]
+			}
+			f.signal[i] = v * f.derivativeWindow[i]
+		}
+		f.plan.Forward(f.signal, f.dre, f.dim)
+
+		for b := range f.magnitudes[k] {
+			power := f.re[b]*f.re[b] + f.im[b]*f.im[b]
+
+			f.magnitudes[k][b] = math.Sqrt(power)
+			f.phases[k][b] = math.Atan2(f.im[b], f.re[b])
+
+			// The instantaneous frequency is given by the frequency of the
+			// bin, corrected by the ratio of the spectra computed with the
+			// derivative of the window and with the window itself.
+			f.frequencies[k][b] = 2 * math.Pi * float64(b) / float64(f.fftSize)
+			if power > 1e-20 {
+				f.frequencies[k][b] -= (f.dim[b]*f.re[b] - f.dre[b]*f.im[b]) / power
+			}
+
+			f.phases[k][b] = math.Remainder(f.phases[k][b]-f.frequencies[k][b]*shift, 2*math.Pi)
+		}
+
+		for i := range f.overlap[k] {
+			f.overlap[k][i] = 0
+		}
+		f.output[k] = f.output[k][:0]
+	}
+
+	// Generate the frames preceding the first output sample, so that the
+	// generated signal does not fade in.
+	for i := 0; i < f.fftSize/f.hop-1; i++ {
+		f.synthesizeFrame()
+	}
+	for k := range f.output {
+		f.output[k] = f.output[k][:0]
+	}
+}
+
+// synthesizeFrame generates a synthesis frame from the spectrum, adds it to
+// the overlap buffer, advances the phases by one hop, and moves the samples
+// that are complete to the output.
+func (f *freezer) synthesizeFrame() {
+	n := f.fftSize
+
+	for k := range f.magnitudes {
+		for b, magnitude := range f.magnitudes[k] {
+			f.re[b] = magnitude * math.Cos(f.phases[k][b])
+			f.im[b] = magnitude * math.Sin(f.phases[k][b])
+
+			f.phases[k][b] = math.Remainder(f.phases[k][b]+f.frequencies[k][b]*float64(f.hop), 2*math.Pi)
+		}
+		f.plan.Inverse(f.re, f.im, f.signal)
+
+		for i, v := range f.signal {
+			f.overlap[k][i] += v * f.synthesisWindow[i]
+		}
+
+		for i := 0; i < f.hop; i++ {
+			f.output[k] = append(f.output[k], f.overlap[k][i]/f.normalizeWindow[i])
+		}
+		copy(f.overlap[k], f.overlap[k][f.hop:])
+		for i := n - f.hop; i < n; i++ {
+			f.overlap[k][i] = 0
+		}
+	}
+}
+
+// read writes the next frame.Len() samples of the generated signal to frame,
+// and then discards the first hop samples.
+func (f *freezer) read(frame multichannel.TSMBuffer, hop int) {
+	for len(f.output[0]) < frame.Len() || len(f.output[0]) < hop {
+		f.synthesizeFrame()
+	}
+
+	for k := range frame {
+		copy(frame[k], f.output[k])
+		f.output[k] = append(f.output[k][:0], f.output[k][hop:]...)
+	}
+}
+
+// release cross-fades the first length samples of frame, which is the first
+// analysis frame read from the input signal after the TSM was frozen, with the
+// generated signal, in order to avoid a discontinuity.
+func (f *freezer) release(frame multichannel.TSMBuffer, length int) {
+	if length > frame.Len() {
+		length = frame.Len()
+	}
+
+	f.read(f.frame, 0)
+	for k := range frame {
+		for i := 0; i < length; i++ {
+			ratio := float64(i+1) / float64(length+1)
+			frame[k][i] = (1-ratio)*f.frame[k][i] + ratio*frame[k][i]
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+type freezerTest struct {
+	frequency float64
+	amplitude float64
+}
+
+var freezerTests = []freezerTest{
+	{0.0113, 1},
+	{0.05, 0.5},
+	{0.1234, 0.25},
+	{0.3, 0.8},
+}
+
+func TestFreezer(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		frameLength = 1024
+		hop         = 256
+		frames      = 200
+	)
+
+	for _, c := range freezerTests {
+		frame := multichannel.NewTSMBuffer(1, frameLength)
+		for i := range frame[0] {
+			frame[0][i] = c.amplitude * math.Sin(2*math.Pi*c.frequency*float64(i))
+		}
+
+		f := newFreezer(1, frameLength)
+		f.analyze(frame)
+
+		// Concatenate the first hop samples of each frame, which should give
+		// a continuous sine wave.
+		signal := make([]float64, 0, frames*hop)
+		for i := 0; i < frames; i++ {
+			f.read(frame, hop)
+			signal = append(signal, frame[0][:hop]...)
+		}
+
+		var energy float64
+		var crossings int
+		for i, v := range signal {
+			energy += v * v
+			if i > 0 && (v >= 0) != (signal[i-1] >= 0) {
+				crossings++
+			}
+		}
+		rms := math.Sqrt(energy / float64(len(signal)))
+		frequency := float64(crossings) / 2 / float64(len(signal))
+
+		msg := fmt.Sprintf("freezer (frequency %v)", c.frequency)
+		assert.InEpsilon(c.amplitude/math.Sqrt2, rms, 0.02, msg)
+		assert.InEpsilon(c.frequency, frequency, 0.01, msg)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// holdTest describes how a TSM with the given synthesis hop is frozen and
+// released: freeze is called after the first holdAt input samples were put,
+// and release after holdSteps more calls to Put.
+type holdTest struct {
+	name      string
+	new       func() (*tsm.TSM, error)
+	hop       int
+	holdAt    int
+	holdSteps int
+	freeze    func(t *tsm.TSM)
+	release   func(t *tsm.TSM)
+}
+
+// newRectangular returns a TSM whose synthesis frames do not overlap, so that
+// the transitions between the input signal and the frozen sound are only
+// smoothed by the freezer.
+func newRectangular() (*tsm.TSM, error) {
+	return tsm.New(tsm.Settings{
+		Channels:     1,
+		AnalysisHop:  1024,
+		SynthesisHop: 1024,
+		FrameLength:  1024,
+		Converter:    identityConverter{},
+	})
+}
+
+// newOLAHold returns a TSM implementing the OLA procedure at a speed of 1.
+func newOLAHold() (*tsm.TSM, error) {
+	return newOLA(1, 1)
+}
+
+var holdTests = []holdTest{
+	{"SetHold", newOLAHold, 64, 2048, 40, func(t *tsm.TSM) { t.SetHold(true) }, func(t *tsm.TSM) { t.SetHold(false) }},
+	{"SetSpeed(0)", newOLAHold, 64, 2048, 40, func(t *tsm.TSM) { t.SetSpeed(0) }, func(t *tsm.TSM) { t.SetSpeed(1) }},
+	{"SetHold (long)", newOLAHold, 64, 1000, 200, func(t *tsm.TSM) { t.SetHold(true) }, func(t *tsm.TSM) { t.SetHold(false) }},
+	{"SetHold (rectangular)", newRectangular, 1024, 2048, 40, func(t *tsm.TSM) { t.SetHold(true) }, func(t *tsm.TSM) { t.SetHold(false) }},
+	{"SetSpeed(0) (rectangular)", newRectangular, 1024, 2048, 40, func(t *tsm.TSM) { t.SetSpeed(0) }, func(t *tsm.TSM) { t.SetSpeed(1) }},
+}
+
+// receiveAll receives all the samples that are ready from the TSM t, and
+// appends them to output.
+func receiveAll(t *tsm.TSM, output []float64) []float64 {
+	buffer := multichannel.NewTSMBuffer(1, 64)
+	for {
+		n, _ := t.Receive(buffer)
+		output = append(output, buffer[0][:n]...)
+		if n < buffer.Len() {
+			return output
+		}
+	}
+}
+
+func TestHold(t *testing.T) {
+	assert := assert.New(t)
+
+	input := sine(1, 8192)
+	for _, c := range holdTests {
+		t1, err := c.new()
+		if !assert.NoError(err) {
+			continue
+		}
+
+		var output []float64
+		var heldFrom, heldTo, steps int
+		frozen := false
+		for position := 0; position < input.Len(); {
+			end := position + 64
+			if end > input.Len() {
+				end = input.Len()
+			}
+			n, _ := t1.Put(input.Slice(position, end))
+			position += n
+			output = receiveAll(t1, output)
+
+			// While the TSM is frozen, the output goes on, and the input
+			// samples are buffered without being processed
+			if frozen {
+				steps++
+				if steps == c.holdSteps {
+					heldTo = len(output)
+					c.release(t1)
+					frozen = false
+				}
+			} else if steps == 0 && position >= c.holdAt {
+				c.freeze(t1)
+				frozen = true
+				heldFrom = len(output)
+			}
+		}
+
+		buffer := multichannel.NewTSMBuffer(1, 64)
+		for {
+			n, err := t1.Flush(buffer)
+			assert.NoError(err, c.name)
+			output = append(output, buffer[0][:n]...)
+			if n < buffer.Len() {
+				break
+			}
+		}
+
+		// The frozen sound, made of whole synthesis frames, is inserted in
+		// the input signal
+		assert.True(heldTo-heldFrom > 0, c.name)
+		assert.Equal(0, (heldTo-heldFrom)%c.hop, c.name)
+		assert.Equal(input.Len()+heldTo-heldFrom, len(output), c.name)
+
+		// The frozen sound is a sine wave with the same amplitude
+		var energy float64
+		for _, v := range output[heldFrom:heldTo] {
+			energy += v * v
+		}
+		rms := math.Sqrt(energy / float64(heldTo-heldFrom))
+		assert.InEpsilon(1/math.Sqrt2, rms, 0.05, c.name)
+
+		// There are no clicks when the TSM is frozen and released (the
+		// derivative of the sine wave is at most 0.05)
+		for i := 1; i < len(output); i++ {
+			if !assert.InDelta(output[i-1], output[i], 0.075, fmt.Sprintf("%s (sample %d)", c.name, i)) {
+				break
+			}
+		}
+	}
+}
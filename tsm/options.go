@@ -0,0 +1,307 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ReferenceSampleRate is the sampling rate for which the default parameters
+// of the TSM methods (expressed in samples) are tuned. When the sampling rate
+// of a Config is set, these defaults are scaled accordingly.
+const ReferenceSampleRate = 44100
+
+// A Config contains the parameters used to create a TSM with the
+// NewWithOptions function of one of the subpackages of this package. It is
+// created by applying Options to a default Config, in which the speed is 1
+// and all the other fields are zero.
+//
+// The zero values mean that the TSM method should choose a default value.
+// The lengths (FrameLength, SynthesisHop and Tolerance) can be given either in
+// samples, or as durations, which are converted to samples using the
+// SampleRate (or the ReferenceSampleRate if it is not set). If both are set,
+// the number of samples is used. Each method may ignore the parameters it does
+// not use (e.g. the OLA method has no tolerance). The lengths set by the
+// Options should be strictly positive, otherwise the error returned by Err is
+// returned by the NewWithOptions functions.
+//
+// Extra contains the values of the parameters that are specific to a method,
+// indexed by name (see the Method type).
+type Config struct {
+	Speed      float64
+	SampleRate int
+
+	FrameLength          int
+	FrameDuration        time.Duration
+	SynthesisHop         int
+	SynthesisHopDuration time.Duration
+	Tolerance            int
+	ToleranceDuration    time.Duration
+
+	AnalysisWindow  window.Func
+	SynthesisWindow window.Func
+
+	Extra map[string]string
+
+	// The errors of the Options which last set the lengths.
+	frameLengthErr  error
+	synthesisHopErr error
+	toleranceErr    error
+}
+
+// An Option sets one or more parameters of a Config.
+type Option func(c *Config)
+
+// NewConfig returns the Config obtained by applying the options to the
+// default Config, in order.
+func NewConfig(options ...Option) Config {
+	c := Config{
+		Speed: 1,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// Err returns an error if one of the lengths was set to a value which is not
+// strictly positive: it wraps ErrInvalidFrameLength for the frame length,
+// ErrInvalidHop for the synthesis hop, and ErrInvalidDelta for the tolerance.
+func (c Config) Err() error {
+	for _, err := range []error{c.frameLengthErr, c.synthesisHopErr, c.toleranceErr} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lengthError returns nil if positive is true, and otherwise an error
+// wrapping err, explaining that the length of the parameter name should be
+// strictly positive.
+func lengthError(err error, name string, positive bool, value interface{}) error {
+	if positive {
+		return nil
+	}
+	return errors.Wrapf(err, "the %s should be strictly positive, got %v", name, value)
+}
+
+// sampleRate returns the sample rate used to convert durations to samples.
+func (c Config) sampleRate() int {
+	if c.SampleRate > 0 {
+		return c.SampleRate
+	}
+	return ReferenceSampleRate
+}
+
+// Length returns samples if it is strictly positive, the number of samples
+// corresponding to the duration d if it is strictly positive, and def
+// otherwise.
+//
+// It is meant to be used by the TSM methods to get the value of a parameter,
+// e.g. c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024)).
+func (c Config) Length(samples int, d time.Duration, def int) int {
+	if samples > 0 {
+		return samples
+	}
+	if d > 0 {
+		return Samples(d, c.sampleRate())
+	}
+	return def
+}
+
+// Scale converts a number of samples at the ReferenceSampleRate to the same
+// duration at the sample rate of the Config.
+func (c Config) Scale(samples int) int {
+	return (samples*c.sampleRate() + ReferenceSampleRate/2) / ReferenceSampleRate
+}
+
+// Windows returns the analysis and synthesis windows of size n, or the
+// default ones if they are not set (a nil window meaning no window).
+func (c Config) Windows(n int, defaultAnalysis window.Func, defaultSynthesis window.Func) (analysisWindow []float64, synthesisWindow []float64) {
+	analysis := c.AnalysisWindow
+	if analysis == nil {
+		analysis = defaultAnalysis
+	}
+	if analysis != nil {
+		analysisWindow = analysis(n)
+	}
+
+	synthesis := c.SynthesisWindow
+	if synthesis == nil {
+		synthesis = defaultSynthesis
+	}
+	if synthesis != nil {
+		synthesisWindow = synthesis(n)
+	}
+
+	return analysisWindow, synthesisWindow
+}
+
+// WithSpeed sets the speed ratio (1 by default).
+func WithSpeed(speed float64) Option {
+	return func(c *Config) {
+		c.Speed = speed
+	}
+}
+
+// WithSampleRate sets the sampling rate of the signal, in Hz.
+func WithSampleRate(sampleRate int) Option {
+	return func(c *Config) {
+		c.SampleRate = sampleRate
+	}
+}
+
+// WithFrameLength sets the frame length, in samples.
+func WithFrameLength(n int) Option {
+	return func(c *Config) {
+		c.FrameLength = n
+		c.FrameDuration = 0
+		c.frameLengthErr = lengthError(ErrInvalidFrameLength, "frame length", n > 0, n)
+	}
+}
+
+// WithFrameDuration sets the frame length as a duration.
+func WithFrameDuration(d time.Duration) Option {
+	return func(c *Config) {
+		c.FrameLength = 0
+		c.FrameDuration = d
+		c.frameLengthErr = lengthError(ErrInvalidFrameLength, "frame length", d > 0, d)
+	}
+}
+
+// WithSynthesisHop sets the synthesis hop, in samples.
+func WithSynthesisHop(n int) Option {
+	return func(c *Config) {
+		c.SynthesisHop = n
+		c.SynthesisHopDuration = 0
+		c.synthesisHopErr = lengthError(ErrInvalidHop, "synthesis hop", n > 0, n)
+	}
+}
+
+// WithSynthesisHopDuration sets the synthesis hop as a duration.
+func WithSynthesisHopDuration(d time.Duration) Option {
+	return func(c *Config) {
+		c.SynthesisHop = 0
+		c.SynthesisHopDuration = d
+		c.synthesisHopErr = lengthError(ErrInvalidHop, "synthesis hop", d > 0, d)
+	}
+}
+
+// WithTolerance sets the tolerance (the maximum shift of the frames for the
+// methods that align them), in samples.
+func WithTolerance(n int) Option {
+	return func(c *Config) {
+		c.Tolerance = n
+		c.ToleranceDuration = 0
+		c.toleranceErr = lengthError(ErrInvalidDelta, "tolerance", n > 0, n)
+	}
+}
+
+// WithToleranceDuration sets the tolerance as a duration.
+func WithToleranceDuration(d time.Duration) Option {
+	return func(c *Config) {
+		c.Tolerance = 0
+		c.ToleranceDuration = d
+		c.toleranceErr = lengthError(ErrInvalidDelta, "tolerance", d > 0, d)
+	}
+}
+
+// WithAnalysisWindow sets the function used to create the analysis window.
+func WithAnalysisWindow(f window.Func) Option {
+	return func(c *Config) {
+		c.AnalysisWindow = f
+	}
+}
+
+// WithSynthesisWindow sets the function used to create the synthesis window.
+func WithSynthesisWindow(f window.Func) Option {
+	return func(c *Config) {
+		c.SynthesisWindow = f
+	}
+}
+
+// WithExtra sets the value of a parameter specific to a method.
+func WithExtra(name string, value string) Option {
+	return func(c *Config) {
+		if c.Extra == nil {
+			c.Extra = make(map[string]string)
+		}
+		c.Extra[name] = value
+	}
+}
+
+// preset returns an Option setting the frame length, synthesis hop, tolerance
+// and synthesis window together.
+func preset(frame time.Duration, hop time.Duration, tolerance time.Duration, synthesisWindow window.Func) Option {
+	return func(c *Config) {
+		WithFrameDuration(frame)(c)
+		WithSynthesisHopDuration(hop)(c)
+		WithToleranceDuration(tolerance)(c)
+		c.SynthesisWindow = synthesisWindow
+	}
+}
+
+// The presets are Options setting the frame length, the synthesis hop, the
+// tolerance and the synthesis window to values suited to a kind of signal.
+// Since they are given as durations, they depend on the sample rate, and they
+// can be overridden by the Options that follow them.
+var (
+	// PresetSpeech uses short frames, which preserve the consonants.
+	PresetSpeech = preset(20*time.Millisecond, 10*time.Millisecond, 5*time.Millisecond, window.Hanning)
+
+	// PresetMusic uses long frames, which preserve the harmonics.
+	PresetMusic = preset(50*time.Millisecond, 25*time.Millisecond, 10*time.Millisecond, window.Hanning)
+
+	// PresetPercussive uses very short frames, which limit the smearing and
+	// the doubling of transients.
+	PresetPercussive = preset(10*time.Millisecond, 5*time.Millisecond, 2*time.Millisecond, window.Hanning)
+
+	// PresetExtremeStretch uses long frames with a large overlap and a
+	// Blackman window, which give a smoother sound for very low speeds.
+	PresetExtremeStretch = preset(100*time.Millisecond, 25*time.Millisecond, 25*time.Millisecond, window.Blackman)
+
+	// PresetLowLatency uses very short frames and a small tolerance, which
+	// keep the latency of the TSM methods under 15ms (see TSM.Latency), at
+	// the cost of a lower quality, especially for low-pitched sounds.
+	PresetLowLatency = preset(10*time.Millisecond, 5*time.Millisecond, 2500*time.Microsecond, window.Hanning)
+)
+
+// Preset returns the preset with the given name ("speech", "music",
+// "percussive", "extreme-stretch" or "low-latency"), and false if it does not
+// exist.
+func Preset(name string) (Option, bool) {
+	switch name {
+	case "speech":
+		return PresetSpeech, true
+	case "music":
+		return PresetMusic, true
+	case "percussive":
+		return PresetPercussive, true
+	case "extreme-stretch":
+		return PresetExtremeStretch, true
+	case "low-latency":
+		return PresetLowLatency, true
+	}
+	return nil, false
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/sola"
+	"github.com/Muges/go-tsm/solafs"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	c := tsm.NewConfig()
+	assert.Equal(1.0, c.Speed)
+	assert.Equal(1024, c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024)))
+
+	c = tsm.NewConfig(tsm.WithSpeed(2), tsm.WithSampleRate(8000), tsm.WithFrameDuration(20*time.Millisecond))
+	assert.Equal(2.0, c.Speed)
+	assert.Equal(160, c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024)))
+	assert.Equal(186, c.Scale(1024))
+
+	// The last options override the first ones
+	c = tsm.NewConfig(tsm.WithFrameDuration(20*time.Millisecond), tsm.WithFrameLength(100))
+	assert.Equal(100, c.Length(c.FrameLength, c.FrameDuration, 1024))
+	c = tsm.NewConfig(tsm.WithFrameLength(100), tsm.WithFrameDuration(time.Second))
+	assert.Equal(44100, c.Length(c.FrameLength, c.FrameDuration, 1024))
+}
+
+func TestConfigErr(t *testing.T) {
+	assert := assert.New(t)
+
+	// The unset lengths are valid
+	assert.NoError(tsm.NewConfig().Err())
+	assert.NoError(tsm.NewConfig(tsm.PresetSpeech).Err())
+
+	cases := []struct {
+		option tsm.Option
+		err    error
+	}{
+		{tsm.WithFrameLength(0), tsm.ErrInvalidFrameLength},
+		{tsm.WithFrameLength(-5), tsm.ErrInvalidFrameLength},
+		{tsm.WithFrameDuration(-time.Millisecond), tsm.ErrInvalidFrameLength},
+		{tsm.WithSynthesisHop(0), tsm.ErrInvalidHop},
+		{tsm.WithSynthesisHopDuration(0), tsm.ErrInvalidHop},
+		{tsm.WithTolerance(-1), tsm.ErrInvalidDelta},
+		{tsm.WithToleranceDuration(-time.Millisecond), tsm.ErrInvalidDelta},
+	}
+	for i, c := range cases {
+		err := tsm.NewConfig(c.option).Err()
+		assert.True(errors.Is(err, c.err), fmt.Sprintf("Err (%d)", i))
+
+		// An invalid length can be overridden
+		err = tsm.NewConfig(c.option, tsm.PresetMusic).Err()
+		assert.NoError(err, fmt.Sprintf("Err (%d)", i))
+	}
+
+	_, err := wsola.NewWithOptions(1, tsm.WithFrameLength(-5))
+	assert.True(errors.Is(err, tsm.ErrInvalidFrameLength), "wsola.NewWithOptions")
+}
+
+func TestConfigWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	c := tsm.NewConfig()
+	analysisWindow, synthesisWindow := c.Windows(8, nil, window.Hanning)
+	assert.Nil(analysisWindow)
+	assert.Equal(window.Hanning(8), synthesisWindow)
+
+	c = tsm.NewConfig(tsm.WithAnalysisWindow(window.Sine), tsm.WithSynthesisWindow(window.Sine))
+	analysisWindow, synthesisWindow = c.Windows(8, nil, window.Hanning)
+	assert.Equal(window.Sine(8), analysisWindow)
+	assert.Equal(window.Sine(8), synthesisWindow)
+}
+
+type presetTest struct {
+	name         string
+	frameLength  int
+	synthesisHop int
+	tolerance    int
+}
+
+var presetTests = []presetTest{
+	{"speech", 882, 441, 221},
+	{"music", 2205, 1103, 441},
+	{"percussive", 441, 221, 88},
+	{"extreme-stretch", 4410, 1103, 1103},
+	{"low-latency", 441, 221, 110},
+}
+
+func TestPresets(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range presetTests {
+		preset, ok := tsm.Preset(c.name)
+		if !assert.True(ok, fmt.Sprintf("Preset(%q)", c.name)) {
+			continue
+		}
+
+		config := tsm.NewConfig(preset)
+		assert.Equal(c.frameLength, config.Length(config.FrameLength, config.FrameDuration, 0), c.name)
+		assert.Equal(c.synthesisHop, config.Length(config.SynthesisHop, config.SynthesisHopDuration, 0), c.name)
+		assert.Equal(c.tolerance, config.Length(config.Tolerance, config.ToleranceDuration, 0), c.name)
+		assert.NotNil(config.SynthesisWindow, c.name)
+
+		// The presets can be overridden
+		config = tsm.NewConfig(preset, tsm.WithSynthesisHop(10))
+		assert.Equal(10, config.Length(config.SynthesisHop, config.SynthesisHopDuration, 0), c.name)
+	}
+
+	_, ok := tsm.Preset("unknown")
+	assert.False(ok)
+}
+
+func TestOutputDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	methods := []struct {
+		name    string
+		process func(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error)
+	}{
+		{"ola", ola.Process},
+		{"wsola", wsola.Process},
+		{"sola", sola.Process},
+		{"solafs", solafs.Process},
+	}
+
+	input := sine(1, 44100)
+	for _, m := range methods {
+		for _, speed := range []float64{0.5, 0.8, 1, 1.3, 2} {
+			output, err := m.process(input, tsm.WithSpeed(speed))
+			if !assert.NoError(err) {
+				continue
+			}
+
+			// The analysis hops are not integers for most speeds, but the
+			// duration should still be exact
+			expected := int(math.Floor(float64(input.Len())/speed + 0.5))
+			assert.InDelta(expected, output.Len(), 1, fmt.Sprintf("%s (speed %g)", m.name, speed))
+		}
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"context"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/pkg/errors"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// ErrUnsupported is returned when an operation is not supported by a TSM.
+var ErrUnsupported = errors.New("unsupported operation")
+
+// A segment is a part of the output signal computed by ProcessParallel.
+//
+// The output samples in [start, end) are computed by a TSM starting at the
+// analysis frame firstFrame, so that it uses the same analysis frames as a
+// TSM processing the whole signal, preceded by some frames which give it
+// time to reach the same state. The analysis frame firstFrame is centered on
+// the input sample inputStart, and hopRemainder is the rounding error of the
+// analysis hops at this frame. output contains all the samples computed by
+// the TSM, the first one being the output sample offset. The segment overlaps
+// with the previous and the next ones, and they are cross-faded.
+type segment struct {
+	start        int
+	end          int
+	firstFrame   int
+	inputStart   int
+	inputEnd     int
+	hopRemainder float64
+
+	output multichannel.TSMBuffer
+	offset int
+}
+
+// sample returns the output sample i of the channel k computed for the
+// segment, or 0 if it was not computed.
+func (s *segment) sample(k int, i int) float64 {
+	i -= s.offset
+	if i < 0 || i >= s.output.Len() {
+		return 0
+	}
+	return s.output[k][i]
+}
+
+// roundUp returns the smallest multiple of m larger than or equal to n.
+func roundUp(n int, m int) int {
+	return (n + m - 1) / m * m
+}
+
+// ProcessParallel changes the speed of a whole signal, as Process does, by
+// splitting it into segments which are processed concurrently by workers
+// goroutines (or by runtime.GOMAXPROCS(0) goroutines if workers <= 0), and
+// cross-fading the results. segmentLength is the approximate number of input
+// samples in each segment.
+//
+// newTSM is called to create a TSM for each worker, and should always return
+// a new TSM with the same settings and speed. The segments are aligned on the
+// analysis frames that a single TSM would use, and each of them starts a few
+// frames earlier than needed, so that the TSMs processing two adjacent
+// segments give (almost) the same output where they are cross-faded. Since
+// the speed has to be constant, ErrUnsupported is returned if the TSM has a
+// SpeedController or a negative speed, and ErrHeld if it is held.
+func ProcessParallel(newTSM func() (*TSM, error), input multichannel.Buffer, segmentLength int, workers int) (multichannel.TSMBuffer, error) {
+	return ProcessParallelContext(context.Background(), newTSM, input, segmentLength, workers, nil)
+}
+
+// ProcessParallelContext is equivalent to ProcessParallel, but stops and
+// returns ctx.Err() if ctx is cancelled before the end of the processing. If
+// progress is not nil, it is called regularly (but never concurrently) with the
+// number of input samples that have been processed. Since the segments
+// overlap, the total number of samples is slightly larger than input.Len().
+func ProcessParallelContext(ctx context.Context, newTSM func() (*TSM, error), input multichannel.Buffer, segmentLength int, workers int, progress ProgressFunc) (multichannel.TSMBuffer, error) {
+	t, err := newTSM()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkChannels(input); err != nil {
+		return nil, err
+	}
+	if t.holding() {
+		return nil, ErrHeld
+	}
+	if t.controller != nil {
+		return nil, errors.Wrap(ErrUnsupported, "ProcessParallel does not support speed controllers")
+	}
+	if t.reverse() {
+		return nil, errors.Wrap(ErrUnsupported, "ProcessParallel does not support negative speeds")
+	}
+
+	hop := t.s.SynthesisHop
+	speed := t.analysisHop / float64(hop)
+
+	// The lengths are given in output samples, and the segments start on
+	// synthesis frames
+	crossfade := t.s.FrameLength
+	warmup := roundUp(4*t.inputLength()+crossfade, hop)
+	length := roundUp(int(float64(segmentLength)/speed), hop)
+	if length < warmup {
+		length = warmup
+	}
+
+	outputLength := int(float64(input.Len()) / speed)
+	if outputLength <= length+warmup {
+		return ProcessContext(ctx, t, input, progress)
+	}
+
+	// Split the output into segments. The analysis hops are rounded as the
+	// TSM does, so that the rounding errors are exactly the same as for a TSM
+	// processing the whole signal.
+	var segments []*segment
+	frame, position := 0, 0
+	for start := 0; start < outputLength; start += length {
+		s := &segment{
+			start: start - crossfade/2,
+			end:   start + length + crossfade/2,
+		}
+		if s.start < 0 {
+			s.start = 0
+		}
+		if start > warmup {
+			s.firstFrame = (start - warmup) / hop
+		}
+		for ; frame < s.firstFrame; frame++ {
+			position += t.nextAnalysisHop(t.analysisHop)
+		}
+		s.inputStart = position
+		s.hopRemainder = t.hopRemainder
+
+		// Keep enough input samples after the end of the segment, so that
+		// it is not affected by the end of the input.
+		s.inputEnd = int(math.Ceil(float64(s.end)*speed)) + t.inputLength() + hop
+		if s.inputEnd >= input.Len() || start+length >= outputLength {
+			s.inputEnd = input.Len()
+			s.end = -1
+		}
+
+		segments = append(segments, s)
+		if s.end < 0 {
+			break
+		}
+	}
+
+	t.hopRemainder = 0
+
+	// Process the segments
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(segments) {
+		workers = len(segments)
+	}
+
+	tsms := []*TSM{t}
+	for len(tsms) < workers {
+		t, err := newTSM()
+		if err != nil {
+			return nil, err
+		}
+		tsms = append(tsms, t)
+	}
+
+	// Report the progress of all the segments
+	var progressMu sync.Mutex
+	var processed, total int
+	segmentProgress := make([]int, len(segments))
+	for _, s := range segments {
+		total += s.inputEnd - s.inputStart
+	}
+	report := func(i int) ProgressFunc {
+		if progress == nil {
+			return nil
+		}
+		return func(n int, _ int) {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			processed += n - segmentProgress[i]
+			segmentProgress[i] = n
+			progress(processed, total)
+		}
+	}
+
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for _, t := range tsms {
+		wg.Add(1)
+		go func(t *TSM) {
+			defer wg.Done()
+			for i := range jobs {
+				if err := t.processSegment(ctx, segments[i], input, report(i)); err != nil {
+					errs <- err
+					// Skip the remaining segments
+					for range jobs {
+					}
+					return
+				}
+			}
+		}(t)
+	}
+	for i := range segments {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+
+	return stitch(segments, t.s.Channels, t.s.FrameLength/2), nil
+}
+
+// processSegment processes the part of the input needed to compute the output
+// samples of the segment, and stores the result in s.output.
+func (t *TSM) processSegment(ctx context.Context, s *segment, input multichannel.Buffer, progress ProgressFunc) error {
+	t.Clear()
+
+	// Start from the analysis frame firstFrame, with the same rounding error
+	// as a TSM processing the whole signal
+	t.hopRemainder = s.hopRemainder
+
+	output, delay, err := t.process(ctx, input.Slice(s.inputStart, s.inputEnd), progress)
+	if err != nil {
+		return err
+	}
+
+	// The first output sample (after the delay of the converter) corresponds
+	// to the analysis frame firstFrame
+	s.output = output
+	s.offset = s.firstFrame*t.s.SynthesisHop - delay
+	if s.end < 0 {
+		s.end = s.offset + output.Len()
+	}
+
+	return nil
+}
+
+// stitch concatenates the outputs of the segments, cross-fading them where
+// they overlap.
+//
+// Since the TSMs processing two adjacent segments may not have reached exactly
+// the same state (e.g. for methods shifting the analysis frames), they may be
+// slightly out of phase. Each segment is therefore shifted by at most
+// maxShift samples, so as to minimize its difference with the previous one
+// where they overlap. The last segment ends with the last sample computed by
+// its TSM, so it can only be shifted backwards.
+func stitch(segments []*segment, channels int, maxShift int) multichannel.TSMBuffer {
+	output := multichannel.NewTSMBuffer(channels, segments[len(segments)-1].end)
+
+	for i, s := range segments {
+		overlap := 0
+		shift := 0
+		if i > 0 {
+			overlap = segments[i-1].end - s.start
+			if i == len(segments)-1 {
+				shift = bestShift(output, s, overlap, -maxShift, 0)
+			} else {
+				shift = bestShift(output, s, overlap, -maxShift, maxShift)
+			}
+		}
+
+		for k := range output {
+			for j := s.start; j < s.end; j++ {
+				v := s.sample(k, j+shift)
+				if j-s.start < overlap {
+					// Raised-cosine cross-fade with the previous segment
+					w := 0.5 - 0.5*math.Cos(math.Pi*float64(j-s.start+1)/float64(overlap+1))
+					output[k][j] = (1-w)*output[k][j] + w*v
+				} else {
+					output[k][j] = v
+				}
+			}
+		}
+	}
+
+	return output
+}
+
+// bestShift returns the shift in [minShift, maxShift] minimizing the squared
+// difference between the output and the samples of the segment where they
+// overlap. The smallest shifts are preferred in case of equality.
+func bestShift(output multichannel.TSMBuffer, s *segment, overlap int, minShift int, maxShift int) int {
+	var best int
+	bestDistance := math.Inf(1)
+
+	for i := 0; i <= 2*maxShift || i <= -2*minShift; i++ {
+		// 0, -1, 1, -2, 2, ...
+		shift := (i + 1) / 2
+		if i%2 == 1 {
+			shift = -shift
+		}
+		if shift < minShift || shift > maxShift {
+			continue
+		}
+
+		var distance float64
+		for k := range output {
+			for j := s.start; j < s.start+overlap; j++ {
+				d := output[k][j] - s.sample(k, j+shift)
+				distance += d * d
+			}
+			if distance >= bestDistance {
+				break
+			}
+		}
+
+		if distance < bestDistance {
+			best = shift
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+type constantController struct{}
+
+func (c constantController) FrameSpeed(analysisFrame multichannel.TSMBuffer) (float64, bool) {
+	return 1, false
+}
+
+func (c constantController) Clear() {}
+
+func TestProcessParallel(t *testing.T) {
+	assert := assert.New(t)
+
+	input := sine(2, 50000)
+	for _, speed := range []float64{0.5, 1, 1.5} {
+		newTSM := func() (*tsm.TSM, error) {
+			return newOLA(2, speed)
+		}
+
+		t1, err := newTSM()
+		if !assert.NoError(err) {
+			continue
+		}
+		expected, err := tsm.Process(t1, input)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		// The OLA procedure does not depend on the previous frames, so the
+		// output should be the same as the one of Process
+		for _, workers := range []int{0, 1, 3} {
+			output, err := tsm.ProcessParallel(newTSM, input, 5000, workers)
+			if assert.NoError(err) && assert.Equal(expected.Len(), output.Len(), fmt.Sprintf("ProcessParallel (speed %g, %d workers)", speed, workers)) {
+				for k := range expected {
+					assert.InDeltaSlice(expected[k], output[k], 0.000001, fmt.Sprintf("ProcessParallel (speed %g, %d workers)", speed, workers))
+				}
+			}
+		}
+	}
+
+	// The WSOLA procedure depends on the previous frames, so the segments are
+	// shifted to be stitched. The output should have the same length as the
+	// one of Process, without any click (the derivative of the input is at
+	// most 0.063) or silence at the end.
+	input = multichannel.NewTSMBuffer(1, 100000)
+	for i := range input[0] {
+		input[0][i] = 0.5*math.Sin(0.05*float64(i)) + 0.3*math.Sin(0.013*float64(i)) + 0.2*math.Sin(0.17*float64(i))
+	}
+	newTSM := func() (*tsm.TSM, error) {
+		return wsola.NewWithSpeed(1, 1.3, 512, 1024, 512)
+	}
+
+	t1, err := newTSM()
+	if !assert.NoError(err) {
+		return
+	}
+	expected, err := tsm.Process(t1, input)
+	if !assert.NoError(err) {
+		return
+	}
+
+	output, err := tsm.ProcessParallel(newTSM, input, 20000, 4)
+	if assert.NoError(err) && assert.Equal(expected.Len(), output.Len(), "ProcessParallel (WSOLA)") {
+		for i := 1; i < output.Len(); i++ {
+			if !assert.InDelta(output[0][i-1], output[0][i], 0.07, fmt.Sprintf("ProcessParallel (WSOLA, sample %d)", i)) {
+				break
+			}
+		}
+		for i := output.Len() - 1024; i < output.Len(); i++ {
+			if !assert.NotEqual(0.0, output[0][i], fmt.Sprintf("ProcessParallel (WSOLA, sample %d)", i)) {
+				break
+			}
+		}
+	}
+}
+
+func TestProcessParallelErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	input := sine(2, 50000)
+	for _, c := range []struct {
+		prepare func(t *tsm.TSM)
+		err     error
+	}{
+		{func(t *tsm.TSM) { t.SetSpeedController(constantController{}) }, tsm.ErrUnsupported},
+		{func(t *tsm.TSM) { t.SetSpeed(-1) }, tsm.ErrUnsupported},
+		{func(t *tsm.TSM) { t.SetHold(true) }, tsm.ErrHeld},
+	} {
+		_, err := tsm.ProcessParallel(func() (*tsm.TSM, error) {
+			t, err := newOLA(2, 1)
+			if err == nil {
+				c.prepare(t)
+			}
+			return t, err
+		}, input, 5000, 2)
+		assert.True(errors.Is(err, c.err), fmt.Sprintf("ProcessParallel: %v", err))
+	}
+
+	_, err := tsm.ProcessParallel(func() (*tsm.TSM, error) {
+		return newOLA(2, 1)
+	}, sine(1, 50000), 5000, 2)
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch))
+}
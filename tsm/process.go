@@ -0,0 +1,155 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"context"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/pkg/errors"
+)
+
+// ErrHeld is returned by Process when the TSM is held, since the output would
+// be infinite.
+var ErrHeld = errors.New("the TSM is held")
+
+// A ProgressFunc is called by ProcessContext and ProcessParallelContext to
+// report that processed input samples out of total have been processed.
+type ProgressFunc func(processed int, total int)
+
+// processChunkLength is the maximal number of samples that Process receives
+// from the TSM at once.
+const processChunkLength = 4096
+
+// Process changes the speed of a whole signal with the TSM t, and returns the
+// result. It puts the input samples in the TSM, receives the output samples,
+// and flushes the TSM at the end, which is therefore cleared and can be used
+// on another signal. If the Converter of the TSM delays its output (see
+// DelayConverter), the delay is removed from the beginning of the result.
+//
+// The TSM should have been cleared or just created, unless the signal is
+// played backwards (in which case the TSM should have been prepared with
+// SetHistory and Seek). An error wrapping multichannel.ErrChannelMismatch is
+// returned if the input does not have the same number of channels as the TSM,
+// and ErrHeld if the TSM is held.
+func Process(t *TSM, input multichannel.Buffer) (multichannel.TSMBuffer, error) {
+	return ProcessContext(context.Background(), t, input, nil)
+}
+
+// ProcessContext is equivalent to Process, but stops and returns ctx.Err() if
+// ctx is cancelled before the end of the processing, in which case the TSM is
+// cleared. If progress is not nil, it is called regularly with the number of
+// input samples that have been processed, the last call being
+// progress(input.Len(), input.Len()).
+func ProcessContext(ctx context.Context, t *TSM, input multichannel.Buffer, progress ProgressFunc) (multichannel.TSMBuffer, error) {
+	output, delay, err := t.process(ctx, input, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the silence returned by the converter before its first output
+	// sample, so that the output is aligned with the input
+	if delay > output.Len() {
+		delay = output.Len()
+	}
+	for k := range output {
+		output[k] = output[k][delay:]
+	}
+
+	return output, nil
+}
+
+// process implements ProcessContext, and also returns the delay of the
+// converter (see DelayConverter).
+func (t *TSM) process(ctx context.Context, input multichannel.Buffer, progress ProgressFunc) (multichannel.TSMBuffer, int, error) {
+	if err := t.checkChannels(input); err != nil {
+		return nil, 0, err
+	}
+	if t.holding() {
+		return nil, 0, ErrHeld
+	}
+
+	output := multichannel.NewTSMBuffer(t.s.Channels, 0)
+	chunk := multichannel.NewTSMBuffer(t.s.Channels, processChunkLength)
+	appendChunk := func(n int) {
+		for k := range output {
+			output[k] = append(output[k], chunk[k][:n]...)
+		}
+	}
+
+	for in := 0; in < input.Len(); {
+		if err := ctx.Err(); err != nil {
+			t.Clear()
+			return nil, 0, err
+		}
+		if progress != nil {
+			progress(in, input.Len())
+		}
+
+		end := in + t.RemainingInputSpace()
+		if end > input.Len() {
+			end = input.Len()
+		}
+		n, err := t.Put(input.Slice(in, end))
+		if err != nil {
+			return nil, 0, err
+		}
+		in += n
+
+		for {
+			n, err := t.Receive(chunk)
+			if err != nil {
+				return nil, 0, err
+			}
+			appendChunk(n)
+			if n < chunk.Len() {
+				break
+			}
+		}
+	}
+
+	// The delay is reset when the TSM is cleared by the last call to Flush
+	delay := 0
+	c, isDelayConverter := t.s.Converter.(DelayConverter)
+	for {
+		if err := ctx.Err(); err != nil {
+			t.Clear()
+			return nil, 0, err
+		}
+		if isDelayConverter {
+			delay = c.Delay()
+		}
+
+		n, err := t.Flush(chunk)
+		if err != nil {
+			return nil, 0, err
+		}
+		appendChunk(n)
+		if n < chunk.Len() {
+			break
+		}
+	}
+
+	if progress != nil {
+		progress(input.Len(), input.Len())
+	}
+
+	return output, delay, nil
+}
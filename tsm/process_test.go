@@ -0,0 +1,197 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// newOLA returns a TSM implementing the OLA procedure with the given speed.
+func newOLA(channels int, speed float64) (*tsm.TSM, error) {
+	return tsm.New(tsm.Settings{
+		Channels:        channels,
+		AnalysisHop:     int(64 * speed),
+		SynthesisHop:    64,
+		FrameLength:     256,
+		SynthesisWindow: window.Hanning(256),
+		Converter:       identityConverter{},
+	})
+}
+
+// sine returns a sine signal of the given length.
+func sine(channels int, length int) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(channels, length)
+	for k := range buffer {
+		for i := range buffer[k] {
+			buffer[k][i] = math.Sin(0.05 * float64(i+k))
+		}
+	}
+	return buffer
+}
+
+type processTest struct {
+	speed  float64
+	length int
+	out    int
+}
+
+var processTests = []processTest{
+	{1, 0, 0},
+	{1, 10, 10},
+	{1, 10000, 10000},
+	{0.5, 10000, 20000},
+	{2, 10000, 5000},
+	{-1, 10000, 10000},
+	{-2, 10000, 5000},
+}
+
+func TestProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range processTests {
+		t1, err := newOLA(2, c.speed)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		input := sine(2, c.length)
+		if c.speed < 0 {
+			t1.SetHistory(c.length)
+			t1.Seek(c.length)
+		}
+
+		output, err := tsm.Process(t1, input)
+		if !assert.NoError(err) || !assert.Equal(c.out, output.Len(), fmt.Sprintf("Process (speed %g, length %d)", c.speed, c.length)) {
+			continue
+		}
+
+		if c.speed == 1 {
+			// With a speed of 1, the output should be equal to the input
+			for k := range input {
+				assert.InDeltaSlice(input[k], output[k], 0.000001, fmt.Sprintf("Process (length %d)", c.length))
+			}
+		}
+		if c.speed == -1 {
+			// With a speed of -1, the output should be the reversed input
+			input.Reverse()
+			for k := range input {
+				assert.InDeltaSlice(input[k], output[k], 0.000001, "Process (reverse)")
+			}
+		}
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	t1, err := newOLA(2, 1)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = tsm.Process(t1, sine(1, 100))
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch))
+
+	t1.SetHold(true)
+	_, err = tsm.Process(t1, sine(2, 100))
+	assert.Equal(tsm.ErrHeld, err)
+}
+
+func TestFlush(t *testing.T) {
+	assert := assert.New(t)
+
+	t1, err := newOLA(1, 1)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Flush should process the remaining input samples, and clear the TSM
+	// when all of them were written
+	for i := 0; i < 2; i++ {
+		n, _ := t1.Put(sine(1, 100))
+		assert.Equal(100, n)
+
+		output := multichannel.NewTSMBuffer(1, 60)
+		var length int
+		for {
+			n, err := t1.Flush(output)
+			assert.NoError(err)
+			length += n
+			if n < output.Len() {
+				break
+			}
+		}
+		assert.Equal(100, length, fmt.Sprintf("Flush (%d)", i))
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	assert := assert.New(t)
+
+	input := sine(2, 50000)
+	newTSM := func() (*tsm.TSM, error) {
+		return newOLA(2, 0.8)
+	}
+
+	// Check that the progress is increasing and ends with the total
+	process := map[string]func(ctx context.Context, progress tsm.ProgressFunc) error{
+		"ProcessContext": func(ctx context.Context, progress tsm.ProgressFunc) error {
+			t1, err := newTSM()
+			if err != nil {
+				return err
+			}
+			_, err = tsm.ProcessContext(ctx, t1, input, progress)
+			return err
+		},
+		"ProcessParallelContext": func(ctx context.Context, progress tsm.ProgressFunc) error {
+			_, err := tsm.ProcessParallelContext(ctx, newTSM, input, 5000, 3, progress)
+			return err
+		},
+	}
+	for name, f := range process {
+		var calls, last, total int
+		err := f(context.Background(), func(processed int, t int) {
+			assert.True(processed >= last, fmt.Sprintf("%s: progress %d after %d", name, processed, last))
+			calls++
+			last, total = processed, t
+		})
+		if assert.NoError(err, name) {
+			assert.True(calls > 1, name)
+			assert.Equal(total, last, name)
+			assert.True(total >= input.Len(), name)
+		}
+
+		// Cancel the processing after the first progress report
+		ctx, cancel := context.WithCancel(context.Background())
+		err = f(ctx, func(processed int, total int) {
+			cancel()
+		})
+		assert.Equal(context.Canceled, err, name)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+)
+
+// A Recipe is a serializable description of a TSM, which can be stored (e.g.
+// as JSON or YAML) and used later to create the same TSM.
+//
+// Method is the name of a registered method (see the Register function). The
+// other fields are the values of the parameters of the method (see the
+// Parameter type), and are ignored when they are empty. The lengths are given
+// either in samples (e.g. "1024") or as durations (e.g. "20ms"), and the
+// windows by their names (see window.ByName). Extra contains the values of
+// the parameters that are specific to the method.
+//
+// If SpeedMap is not empty, the speed of the TSM follows it, and Speed is
+// ignored. Otherwise, the speed is given by Speed, or is 1 if it is nil.
+type Recipe struct {
+	Method     string   `json:"method" yaml:"method"`
+	Preset     string   `json:"preset,omitempty" yaml:"preset,omitempty"`
+	Speed      *float64 `json:"speed,omitempty" yaml:"speed,omitempty"`
+	SpeedMap   SpeedMap `json:"speed_map,omitempty" yaml:"speed_map,omitempty"`
+	SampleRate int      `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+
+	FrameLength  string `json:"frame_length,omitempty" yaml:"frame_length,omitempty"`
+	SynthesisHop string `json:"synthesis_hop,omitempty" yaml:"synthesis_hop,omitempty"`
+	Tolerance    string `json:"tolerance,omitempty" yaml:"tolerance,omitempty"`
+
+	AnalysisWindow  string `json:"analysis_window,omitempty" yaml:"analysis_window,omitempty"`
+	SynthesisWindow string `json:"synthesis_window,omitempty" yaml:"synthesis_window,omitempty"`
+
+	Extra map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// parameters returns the names and values of the parameters of the Recipe,
+// in the order in which they should be applied.
+func (r Recipe) parameters() [][2]string {
+	var params [][2]string
+	add := func(name string, value string) {
+		if value != "" {
+			params = append(params, [2]string{name, value})
+		}
+	}
+
+	// The preset is applied first, so that it can be overridden
+	add(ParamPreset.Name, r.Preset)
+	if r.Speed != nil && len(r.SpeedMap) == 0 {
+		add(ParamSpeed.Name, strconv.FormatFloat(*r.Speed, 'g', -1, 64))
+	}
+	if r.SampleRate != 0 {
+		add(ParamSampleRate.Name, strconv.Itoa(r.SampleRate))
+	}
+	add(ParamFrameLength.Name, r.FrameLength)
+	add(ParamSynthesisHop.Name, r.SynthesisHop)
+	add(ParamTolerance.Name, r.Tolerance)
+	add(ParamAnalysisWindow.Name, r.AnalysisWindow)
+	add(ParamSynthesisWindow.Name, r.SynthesisWindow)
+
+	names := make([]string, 0, len(r.Extra))
+	for name := range r.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, r.Extra[name])
+	}
+
+	return params
+}
+
+// Options returns the method of the Recipe, and the options corresponding to
+// its parameters. It returns an error if the method is not registered, if it
+// does not accept one of the parameters, or if one of them is invalid.
+func (r Recipe) Options() (Method, []Option, error) {
+	m, ok := LookupMethod(r.Method)
+	if !ok {
+		return Method{}, nil, errors.Wrapf(ErrUnknownMethod, "\"%s\"", r.Method)
+	}
+	if err := r.SpeedMap.Validate(); err != nil {
+		return Method{}, nil, err
+	}
+
+	var options []Option
+	for _, param := range r.parameters() {
+		option, err := m.option(param[0], param[1])
+		if err != nil {
+			return Method{}, nil, err
+		}
+		options = append(options, option)
+	}
+
+	return m, options, nil
+}
+
+// New returns a TSM for a signal with the given number of channels, created
+// from the Recipe. The options are applied before the parameters of the
+// Recipe.
+func (r Recipe) New(channels int, options ...Option) (*TSM, error) {
+	m, recipeOptions, err := r.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]Option, 0, len(options)+len(recipeOptions))
+	all = append(all, options...)
+	all = append(all, recipeOptions...)
+
+	t, err := m.New(channels, all...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.SpeedMap) > 0 {
+		c := NewConfig(all...)
+		t.SetSpeedController(r.SpeedMap.Controller(t.s.SynthesisHop, c.sampleRate()))
+	}
+
+	return t, nil
+}
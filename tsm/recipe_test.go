@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func float(x float64) *float64 {
+	return &x
+}
+
+var recipes = []tsm.Recipe{
+	{Method: "identity"},
+	{Method: "identity", Speed: float(0)},
+	{Method: "identity", Speed: float(0.1 + 0.2), SampleRate: 48000, FrameLength: "20ms", SynthesisWindow: "kaiser:8.6"},
+	{Method: "identity", SpeedMap: tsm.SpeedMap{{0, 1}, {1.5, 0.5}, {3, 2}}, Extra: map[string]string{"gain": "2"}},
+	{Method: "wsola", Preset: "music", Speed: float(-1), SynthesisHop: "512", Tolerance: "5ms", AnalysisWindow: "hanning"},
+}
+
+func TestRecipeJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, r := range recipes {
+		data, err := json.Marshal(r)
+		if !assert.NoError(err, fmt.Sprintf("Marshal (%d)", i)) {
+			continue
+		}
+
+		var out tsm.Recipe
+		assert.NoError(json.Unmarshal(data, &out), fmt.Sprintf("Unmarshal (%d)", i))
+		assert.Equal(r, out, fmt.Sprintf("JSON round-trip (%d): %s", i, data))
+	}
+}
+
+func TestRecipeYAML(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, r := range recipes {
+		data, err := yaml.Marshal(r)
+		if !assert.NoError(err, fmt.Sprintf("Marshal (%d)", i)) {
+			continue
+		}
+
+		var out tsm.Recipe
+		assert.NoError(yaml.Unmarshal(data, &out), fmt.Sprintf("Unmarshal (%d)", i))
+		assert.Equal(r, out, fmt.Sprintf("YAML round-trip (%d): %s", i, data))
+	}
+}
+
+func TestRecipeNew(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := recipes[2].New(2)
+	if assert.NoError(err) {
+		assert.Equal(0.1+0.2, lastConfig.Speed)
+		assert.Equal(960, lastConfig.Length(lastConfig.FrameLength, lastConfig.FrameDuration, 0))
+	}
+
+	_, err = recipes[3].New(2)
+	if assert.NoError(err) {
+		assert.Equal(map[string]string{"gain": "2"}, lastConfig.Extra)
+	}
+
+	_, err = tsm.Recipe{Method: "unknown"}.New(2)
+	assert.True(errors.Is(err, tsm.ErrUnknownMethod))
+
+	_, err = tsm.Recipe{Method: "identity", Tolerance: "10"}.New(2)
+	assert.True(errors.Is(err, tsm.ErrUnknownParameter))
+
+	_, err = tsm.Recipe{Method: "identity", SynthesisWindow: "unknown"}.New(2)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter))
+
+	_, err = tsm.Recipe{Method: "identity", SpeedMap: tsm.SpeedMap{{1, 1}, {0, 2}}}.New(2)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter))
+
+	_, err = tsm.Recipe{Method: "identity", SpeedMap: tsm.SpeedMap{{0, 1}, {1, 0}}}.New(2)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter))
+
+	_, err = tsm.Recipe{Method: "identity", SpeedMap: tsm.SpeedMap{{0, -1}}}.New(2)
+	assert.True(errors.Is(err, tsm.ErrInvalidParameter))
+}
+
+func TestRecipeReuse(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := tsm.Recipe{Method: "identity", SpeedMap: tsm.SpeedMap{{0, 2}, {1, 0.5}}}.New(1)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The speed map should start again from the beginning for the second
+	// signal
+	input := sine(1, 44100)
+	first, err := tsm.Process(s, input)
+	assert.NoError(err)
+	second, err := tsm.Process(s, input)
+	assert.NoError(err)
+	assert.Equal(first.Len(), second.Len())
+}
+
+type speedMapTest struct {
+	time  float64
+	speed float64
+}
+
+var speedMapTests = []speedMapTest{
+	{-1, 1},
+	{0, 1},
+	{0.75, 0.75},
+	{1.5, 0.5},
+	{2.5, 1.5},
+	{3, 2},
+	{10, 2},
+}
+
+func TestSpeedMap(t *testing.T) {
+	assert := assert.New(t)
+
+	m := tsm.SpeedMap{{0, 1}, {1.5, 0.5}, {3, 2}}
+	for _, c := range speedMapTests {
+		assert.InDelta(c.speed, m.At(c.time), 0.000001, fmt.Sprintf("At(%g)", c.time))
+	}
+	assert.Equal(1.0, tsm.SpeedMap{}.At(1))
+
+	// A controller with a hop of 0.5s reads the frames at 0, 0.5, 0.5+0.5*5/6, ...
+	controller := m.Controller(1, 2)
+	speed, drop := controller.FrameSpeed(nil)
+	assert.Equal(1.0, speed)
+	assert.False(drop)
+	speed, _ = controller.FrameSpeed(nil)
+	assert.InDelta(5.0/6, speed, 0.000001)
+}
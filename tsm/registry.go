@@ -0,0 +1,288 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownMethod is returned when a TSM method is not registered.
+	ErrUnknownMethod = errors.New("unknown TSM method")
+	// ErrUnknownParameter is returned when a method specification contains
+	// a parameter that the method does not accept.
+	ErrUnknownParameter = errors.New("unknown parameter")
+	// ErrInvalidParameter is returned when the value of a parameter of a
+	// method specification cannot be parsed.
+	ErrInvalidParameter = errors.New("invalid parameter value")
+)
+
+// A Factory returns a TSM for a signal with the given number of channels,
+// configured by the options.
+type Factory func(channels int, options ...Option) (*TSM, error)
+
+// A Parameter describes a parameter that can be given to a TSM method in a
+// method specification (see the Parse function).
+type Parameter struct {
+	Name        string
+	Description string
+
+	// Parse returns the Option setting the parameter to the value. If it is
+	// nil, the value is stored in the Extra field of the Config.
+	Parse func(value string) (Option, error)
+}
+
+// The parameters common to the TSM methods. The lengths can either be given
+// in samples (e.g. "1024") or as durations (e.g. "20ms").
+var (
+	ParamSpeed = Parameter{
+		Name:        "speed",
+		Description: "the speed ratio",
+		Parse: func(value string) (Option, error) {
+			speed, err := strconv.ParseFloat(value, 64)
+			return WithSpeed(speed), err
+		},
+	}
+	ParamSampleRate = Parameter{
+		Name:        "sample_rate",
+		Description: "the sampling rate of the signal, in Hz",
+		Parse: func(value string) (Option, error) {
+			sampleRate, err := strconv.Atoi(value)
+			return WithSampleRate(sampleRate), err
+		},
+	}
+	ParamFrameLength = Parameter{
+		Name:        "frame_length",
+		Description: "the frame length, in samples or as a duration",
+		Parse:       parseLength(WithFrameLength, WithFrameDuration),
+	}
+	ParamSynthesisHop = Parameter{
+		Name:        "synthesis_hop",
+		Description: "the synthesis hop, in samples or as a duration",
+		Parse:       parseLength(WithSynthesisHop, WithSynthesisHopDuration),
+	}
+	ParamTolerance = Parameter{
+		Name:        "tolerance",
+		Description: "the maximum shift of the frames, in samples or as a duration",
+		Parse:       parseLength(WithTolerance, WithToleranceDuration),
+	}
+	ParamAnalysisWindow = Parameter{
+		Name:        "analysis_window",
+		Description: "the name of the analysis window (see window.ByName)",
+		Parse:       parseWindow(WithAnalysisWindow),
+	}
+	ParamSynthesisWindow = Parameter{
+		Name:        "synthesis_window",
+		Description: "the name of the synthesis window (see window.ByName)",
+		Parse:       parseWindow(WithSynthesisWindow),
+	}
+	ParamPreset = Parameter{
+		Name:        "preset",
+		Description: "the name of a preset (speech, music, percussive, extreme-stretch or low-latency)",
+		Parse: func(value string) (Option, error) {
+			preset, ok := Preset(value)
+			if !ok {
+				return nil, errors.Errorf("unknown preset \"%s\"", value)
+			}
+			return preset, nil
+		},
+	}
+)
+
+// parseLength returns a function parsing a length given either in samples or
+// as a duration, which should be strictly positive (see Config.Err).
+func parseLength(samples func(int) Option, duration func(time.Duration) Option) func(string) (Option, error) {
+	return func(value string) (Option, error) {
+		var option Option
+		if n, err := strconv.Atoi(value); err == nil {
+			option = samples(n)
+		} else {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			option = duration(d)
+		}
+
+		c := NewConfig(option)
+		return option, c.Err()
+	}
+}
+
+// parseWindow returns a function parsing the name of a window.
+func parseWindow(option func(window.Func) Option) func(string) (Option, error) {
+	return func(value string) (Option, error) {
+		f, err := window.ByName(value)
+		return option(f), err
+	}
+}
+
+// A Method describes a TSM method that can be selected by name.
+type Method struct {
+	Name        string
+	Description string
+	Parameters  []Parameter
+	New         Factory
+}
+
+// parameter returns the parameter of the method with the given name, and false
+// if it does not exist.
+func (m Method) parameter(name string) (Parameter, bool) {
+	for _, p := range m.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// option returns the Option setting the parameter of the method with the given
+// name to the value.
+func (m Method) option(name string, value string) (Option, error) {
+	p, ok := m.parameter(name)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownParameter, "\"%s\" for method %s", name, m.Name)
+	}
+
+	if p.Parse == nil {
+		return WithExtra(name, value), nil
+	}
+
+	option, err := p.Parse(value)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidParameter, "\"%s\" for parameter %s: %v", value, name, err)
+	}
+	return option, nil
+}
+
+var (
+	methodsMu sync.RWMutex
+	methods   = make(map[string]Method)
+)
+
+// Register makes a TSM method available by its name. It is meant to be called
+// from the init function of the package implementing the method, which should
+// then be imported for its side effects:
+//
+//    import _ "github.com/Muges/go-tsm/wsola"
+//
+// Register panics if the name is empty or contains a colon, if the factory is
+// nil, or if a method with the same name is already registered.
+func Register(m Method) {
+	methodsMu.Lock()
+	defer methodsMu.Unlock()
+
+	if m.Name == "" || strings.Contains(m.Name, ":") {
+		panic("tsm: invalid method name \"" + m.Name + "\"")
+	}
+	if m.New == nil {
+		panic("tsm: Register factory is nil for method " + m.Name)
+	}
+	if _, dup := methods[m.Name]; dup {
+		panic("tsm: Register called twice for method " + m.Name)
+	}
+	methods[m.Name] = m
+}
+
+// Methods returns the sorted names of the registered methods.
+func Methods() []string {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupMethod returns the registered method with the given name, and false if
+// it does not exist.
+func LookupMethod(name string) (Method, bool) {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+
+	m, ok := methods[name]
+	return m, ok
+}
+
+// Parse parses a method specification, which is the name of a registered
+// method, optionally followed by a colon and a comma-separated list of
+// parameters:
+//
+//    wsola
+//    wsola:speed=0.8,frame_length=40ms,tolerance=512
+//
+// It returns the method, and the options corresponding to the parameters.
+func Parse(spec string) (Method, []Option, error) {
+	name, params := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, params = spec[:i], spec[i+1:]
+	}
+
+	m, ok := LookupMethod(name)
+	if !ok {
+		return Method{}, nil, errors.Wrapf(ErrUnknownMethod, "\"%s\"", name)
+	}
+	if params == "" {
+		return m, nil, nil
+	}
+
+	var options []Option
+	for _, param := range strings.Split(params, ",") {
+		i := strings.Index(param, "=")
+		if i < 0 {
+			return Method{}, nil, errors.Wrapf(ErrInvalidParameter, "missing value for parameter \"%s\"", param)
+		}
+		key, value := strings.TrimSpace(param[:i]), strings.TrimSpace(param[i+1:])
+
+		option, err := m.option(key, value)
+		if err != nil {
+			return Method{}, nil, err
+		}
+		options = append(options, option)
+	}
+
+	return m, options, nil
+}
+
+// NewFromString returns a TSM for a signal with the given number of channels,
+// using the method specification spec (see the Parse function). The options
+// are applied before the parameters of the specification.
+func NewFromString(channels int, spec string, options ...Option) (*TSM, error) {
+	m, specOptions, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]Option, 0, len(options)+len(specOptions))
+	all = append(all, options...)
+	all = append(all, specOptions...)
+
+	return m.New(channels, all...)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// lastConfig is the Config given to the factory of the identity method.
+var lastConfig tsm.Config
+
+func init() {
+	tsm.Register(tsm.Method{
+		Name:       "identity",
+		Parameters: []tsm.Parameter{tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamFrameLength, tsm.ParamSynthesisWindow, {Name: "gain"}},
+		New: func(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+			lastConfig = tsm.NewConfig(options...)
+			frameLength := lastConfig.Length(lastConfig.FrameLength, lastConfig.FrameDuration, 256)
+
+			return tsm.New(tsm.Settings{
+				Channels:     channels,
+				AnalysisHop:  int(float64(frameLength) * lastConfig.Speed),
+				SynthesisHop: frameLength,
+				FrameLength:  frameLength,
+				Converter:    identityConverter{},
+			})
+		},
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Contains(tsm.Methods(), "identity")
+	_, ok := tsm.LookupMethod("identity")
+	assert.True(ok)
+
+	assert.Panics(func() {
+		tsm.Register(tsm.Method{Name: "identity", New: func(int, ...tsm.Option) (*tsm.TSM, error) { return nil, nil }})
+	}, "Register twice")
+	assert.Panics(func() {
+		tsm.Register(tsm.Method{Name: "nil"})
+	}, "Register without factory")
+}
+
+func TestNewFromString(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := tsm.NewFromString(2, "identity")
+	if assert.NoError(err) {
+		assert.Equal(1.0, lastConfig.Speed)
+	}
+
+	_, err = tsm.NewFromString(2, "identity:speed=0.5, frame_length=20ms,gain=2,synthesis_window=kaiser:8.6", tsm.WithSampleRate(8000), tsm.WithSpeed(2))
+	if assert.NoError(err) {
+		assert.Equal(0.5, lastConfig.Speed)
+		assert.Equal(8000, lastConfig.SampleRate)
+		assert.Equal(160, lastConfig.Length(lastConfig.FrameLength, lastConfig.FrameDuration, 0))
+		assert.Equal(map[string]string{"gain": "2"}, lastConfig.Extra)
+		assert.NotNil(lastConfig.SynthesisWindow)
+	}
+
+	_, err = tsm.NewFromString(2, "unknown:speed=2")
+	assert.True(errors.Is(err, tsm.ErrUnknownMethod), "unknown method")
+
+	_, err = tsm.NewFromString(2, "identity:tolerance=10")
+	assert.True(errors.Is(err, tsm.ErrUnknownParameter), "unknown parameter")
+
+	for _, spec := range []string{"identity:speed", "identity:speed=fast", "identity:frame_length=1s2", "identity:frame_length=-5", "identity:frame_length=0ms", "identity:synthesis_window=unknown"} {
+		_, err = tsm.NewFromString(2, spec)
+		assert.True(errors.Is(err, tsm.ErrInvalidParameter), spec)
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, value := range []string{"512", "20ms"} {
+		_, err := tsm.ParamFrameLength.Parse(value)
+		assert.NoError(err, value)
+	}
+
+	_, err := tsm.ParamFrameLength.Parse("-5")
+	assert.True(errors.Is(err, tsm.ErrInvalidFrameLength))
+	_, err = tsm.ParamSynthesisHop.Parse("0")
+	assert.True(errors.Is(err, tsm.ErrInvalidHop))
+	_, err = tsm.ParamTolerance.Parse("-1ms")
+	assert.True(errors.Is(err, tsm.ErrInvalidDelta))
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/internal/fft"
+	"github.com/Muges/go-tsm/internal/parallel"
+	"github.com/Muges/go-tsm/multichannel"
+)
+
+// A Spectrum contains the discrete Fourier transforms of the channels of a
+// frame. Re[k][i] and Im[k][i] are the real and imaginary parts of the bin i of
+// the channel k, for i in [0, Size/2], the other bins being deduced from them
+// since the frame is real. The frequency of the bin i is i*sampleRate/Size.
+type Spectrum struct {
+	Re   [][]float64
+	Im   [][]float64
+	Size int
+}
+
+// A SpectralProcessor modifies the spectra of the frames processed by a
+// Converter created by NewSpectralConverter.
+type SpectralProcessor interface {
+	// ProcessSpectrum modifies the spectrum of a frame in place.
+	ProcessSpectrum(spectrum Spectrum)
+
+	// Clear clears the state of the SpectralProcessor, making it ready to
+	// be used on another signal (or another part of a signal).
+	Clear()
+}
+
+// SpectralFunc is an adapter allowing to use a function without state as a
+// SpectralProcessor.
+type SpectralFunc func(spectrum Spectrum)
+
+// ProcessSpectrum calls f(spectrum).
+func (f SpectralFunc) ProcessSpectrum(spectrum Spectrum) {
+	f(spectrum)
+}
+
+// Clear does nothing.
+func (f SpectralFunc) Clear() {}
+
+// spectralConverter is a Converter applying SpectralProcessors to the spectra
+// of the frames.
+type spectralConverter struct {
+	processors []SpectralProcessor
+
+	plan           *fft.RealPlan
+	signal         [][]float64
+	spectrum       Spectrum
+	synthesisFrame multichannel.TSMBuffer
+}
+
+// NewSpectralConverter returns a Converter which computes the spectrum of each
+// frame, modifies it with each of the processors in order, and returns the
+// corresponding frame. The Fourier transform is therefore only computed once
+// for all the processors.
+//
+// The frames are padded with zeros to the next length whose only prime factors
+// are 2, 3 and 5 before computing their spectrum, and the synthesis frames
+// have the same length as the analysis frames. Since the analysis and
+// synthesis windows are applied by the TSM, the Converter can be used in a
+// Chain after a TSM method, or as the Converter of a TSM with the analysis and
+// synthesis windows of an STFT.
+func NewSpectralConverter(processors ...SpectralProcessor) Converter {
+	return &spectralConverter{
+		processors: append([]SpectralProcessor(nil), processors...),
+	}
+}
+
+// Convert applies the processors to the spectrum of the analysis frame.
+func (c *spectralConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	channels, length := analysisFrame.Channels(), analysisFrame.Len()
+	if c.synthesisFrame.Channels() != channels || c.synthesisFrame.Len() != length {
+		size := fft.NextFastSize(length)
+		c.plan = fft.RealPlanFor(size)
+		c.signal = multichannel.NewTSMBuffer(channels, size)
+		c.spectrum = Spectrum{
+			Re:   multichannel.NewTSMBuffer(channels, c.plan.Bins()),
+			Im:   multichannel.NewTSMBuffer(channels, c.plan.Bins()),
+			Size: size,
+		}
+		c.synthesisFrame = multichannel.NewTSMBuffer(channels, length)
+	}
+	size := c.plan.Len()
+
+	parallel.ForEachChannel(channels, size, func(k int) {
+		copy(c.signal[k], analysisFrame[k])
+		for i := length; i < size; i++ {
+			c.signal[k][i] = 0
+		}
+		c.plan.Forward(c.signal[k], c.spectrum.Re[k], c.spectrum.Im[k])
+	})
+
+	for _, processor := range c.processors {
+		processor.ProcessSpectrum(c.spectrum)
+	}
+
+	parallel.ForEachChannel(channels, size, func(k int) {
+		c.plan.Inverse(c.spectrum.Re[k], c.spectrum.Im[k], c.signal[k])
+		copy(c.synthesisFrame[k], c.signal[k][:length])
+	})
+
+	return c.synthesisFrame
+}
+
+// Clear clears the state of the processors.
+func (c *spectralConverter) Clear() {
+	for _, processor := range c.processors {
+		processor.Clear()
+	}
+}
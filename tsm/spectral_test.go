@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// A gainConverter multiplies the frames by gain, and records the analysis hops
+// and the calls to Clear.
+type gainConverter struct {
+	gain    float64
+	delay   int
+	latency int
+	hop     int
+	cleared bool
+}
+
+func (c *gainConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	synthesisFrame := multichannel.NewTSMBuffer(analysisFrame.Channels(), analysisFrame.Len())
+	for k := range analysisFrame {
+		for i, v := range analysisFrame[k] {
+			synthesisFrame[k][i] = c.gain * v
+		}
+	}
+	return synthesisFrame
+}
+
+func (c *gainConverter) Clear() {
+	c.cleared = true
+}
+
+func (c *gainConverter) SetAnalysisHop(analysisHop int) {
+	c.hop = analysisHop
+}
+
+func (c *gainConverter) Delay() int {
+	return c.delay
+}
+
+func (c *gainConverter) Latency() int {
+	return c.latency
+}
+
+func TestChain(t *testing.T) {
+	assert := assert.New(t)
+
+	c1 := &gainConverter{gain: 2, delay: 3, latency: 5}
+	c2 := &gainConverter{gain: 0.25, delay: 4, latency: 6}
+	c := tsm.Chain(c1, identityConverter{}, c2)
+
+	frame := c.Convert(multichannel.TSMBuffer{{1, 2}, {-4, 0}})
+	assert.Equal(multichannel.TSMBuffer{{0.5, 1}, {-2, 0}}, frame)
+
+	c.(tsm.HopConverter).SetAnalysisHop(42)
+	assert.Equal(42, c1.hop)
+	assert.Equal(42, c2.hop)
+	assert.Equal(7, c.(tsm.DelayConverter).Delay())
+	assert.Equal(11, c.(tsm.LatencyConverter).Latency())
+
+	c.Clear()
+	assert.True(c1.cleared)
+	assert.True(c2.cleared)
+}
+
+func TestSpectralConverter(t *testing.T) {
+	assert := assert.New(t)
+
+	var cleared bool
+	identity := tsm.SpectralFunc(func(spectrum tsm.Spectrum) {})
+	zero := tsm.SpectralFunc(func(spectrum tsm.Spectrum) {
+		for k := range spectrum.Re {
+			for i := range spectrum.Re[k] {
+				spectrum.Re[k][i] = 0
+				spectrum.Im[k][i] = 0
+			}
+		}
+	})
+	// Keep only the bins of a sine of period 8 samples
+	bandPass := tsm.SpectralFunc(func(spectrum tsm.Spectrum) {
+		for k := range spectrum.Re {
+			for i := range spectrum.Re[k] {
+				if i != spectrum.Size/8 {
+					spectrum.Re[k][i] = 0
+					spectrum.Im[k][i] = 0
+				}
+			}
+		}
+	})
+
+	for _, length := range []int{1, 64, 100} {
+		frame := sine(2, length)
+
+		for _, c := range []struct {
+			processors []tsm.SpectralProcessor
+			input      multichannel.TSMBuffer
+			output     multichannel.TSMBuffer
+		}{
+			{nil, frame, frame},
+			{[]tsm.SpectralProcessor{identity, identity}, frame, frame},
+			{[]tsm.SpectralProcessor{identity, zero}, frame, multichannel.NewTSMBuffer(2, length)},
+		} {
+			output := tsm.NewSpectralConverter(c.processors...).Convert(c.input)
+			for k := range c.output {
+				assert.InDeltaSlice(c.output[k], output[k], 1e-9, fmt.Sprintf("Convert (length %d)", length))
+			}
+		}
+
+	}
+
+	periodic := multichannel.NewTSMBuffer(2, 64)
+	noisy := multichannel.NewTSMBuffer(2, 64)
+	for k := range periodic {
+		for i := range periodic[k] {
+			periodic[k][i] = math.Sin(2*math.Pi*float64(i)/8 + float64(k))
+			noisy[k][i] = periodic[k][i] + 0.5 + 0.25*math.Cos(2*math.Pi*float64(i)/4)
+		}
+	}
+	output := tsm.NewSpectralConverter(bandPass).Convert(noisy)
+	for k := range periodic {
+		assert.InDeltaSlice(periodic[k], output[k], 1e-9, "Convert (band-pass)")
+	}
+
+	processor := &spectralRecorder{cleared: &cleared}
+	tsm.NewSpectralConverter(processor).Clear()
+	assert.True(cleared)
+}
+
+type spectralRecorder struct {
+	cleared *bool
+}
+
+func (p *spectralRecorder) ProcessSpectrum(spectrum tsm.Spectrum) {}
+
+func (p *spectralRecorder) Clear() {
+	*p.cleared = true
+}
+
+func TestSetEffect(t *testing.T) {
+	assert := assert.New(t)
+
+	input := sine(2, 5000)
+
+	t1, err := newOLA(2, 0.8)
+	if !assert.NoError(err) {
+		return
+	}
+	expected, err := tsm.Process(t1, input)
+	if !assert.NoError(err) {
+		return
+	}
+
+	effect := &gainConverter{gain: 0.5}
+	t1.SetEffect(tsm.Chain(effect, tsm.NewSpectralConverter()))
+	assert.True(effect.cleared)
+	output, err := tsm.Process(t1, input)
+	if assert.NoError(err) && assert.Equal(expected.Len(), output.Len()) {
+		for k := range expected {
+			for i := range expected[k] {
+				expected[k][i] *= 0.5
+			}
+			assert.InDeltaSlice(expected[k], output[k], 1e-9)
+		}
+	}
+}
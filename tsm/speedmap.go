@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/pkg/errors"
+)
+
+// A SpeedPoint is a point of a SpeedMap, giving the speed at a time (in
+// seconds) of the input signal.
+type SpeedPoint struct {
+	Time  float64 `json:"time" yaml:"time"`
+	Speed float64 `json:"speed" yaml:"speed"`
+}
+
+// A SpeedMap describes a speed varying with the time of the input signal. The
+// speed is interpolated linearly between the points, which should be sorted
+// by time, and is constant before the first point and after the last one.
+type SpeedMap []SpeedPoint
+
+// Validate returns an error if the points of the SpeedMap are not sorted by
+// time, or if one of their speeds is not strictly positive.
+func (m SpeedMap) Validate() error {
+	for i, p := range m {
+		if p.Speed <= 0 {
+			return errors.Wrapf(ErrInvalidParameter, "the speeds of the speed map should be strictly positive, got %g at %g", p.Speed, p.Time)
+		}
+		if i > 0 && p.Time < m[i-1].Time {
+			return errors.Wrapf(ErrInvalidParameter, "the points of the speed map should be sorted by time, got %g after %g", p.Time, m[i-1].Time)
+		}
+	}
+	return nil
+}
+
+// At returns the speed at the time t (in seconds), or 1 if the SpeedMap is
+// empty.
+func (m SpeedMap) At(t float64) float64 {
+	if len(m) == 0 {
+		return 1
+	}
+	if t <= m[0].Time {
+		return m[0].Speed
+	}
+
+	for i := 1; i < len(m); i++ {
+		if t < m[i].Time {
+			p0, p1 := m[i-1], m[i]
+			return p0.Speed + (p1.Speed-p0.Speed)*(t-p0.Time)/(p1.Time-p0.Time)
+		}
+	}
+
+	return m[len(m)-1].Speed
+}
+
+// Controller returns a SpeedController following the SpeedMap, for a TSM with
+// the given synthesis hop processing a signal sampled at sampleRate Hz.
+//
+// The controller estimates the time of the input signal by adding the
+// analysis hops of the frames, starting from 0 when the TSM is cleared. It
+// should therefore not be shared between TSMs, and does not take the Seek
+// method into account.
+func (m SpeedMap) Controller(synthesisHop int, sampleRate int) SpeedController {
+	return &speedMapController{
+		speedMap: m,
+		hop:      float64(synthesisHop) / float64(sampleRate),
+	}
+}
+
+// A speedMapController is a SpeedController following a SpeedMap.
+type speedMapController struct {
+	speedMap SpeedMap
+	hop      float64
+	time     float64
+}
+
+// FrameSpeed returns the speed at the estimated time of the analysis frame.
+func (c *speedMapController) FrameSpeed(analysisFrame multichannel.TSMBuffer) (float64, bool) {
+	speed := c.speedMap.At(c.time)
+	c.time += speed * c.hop
+	return speed, false
+}
+
+// Clear moves the estimated time back to the beginning of the signal.
+func (c *speedMapController) Clear() {
+	c.time = 0
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm
+
+import (
+	"math"
+	"time"
+)
+
+// Samples returns the number of samples corresponding to the duration d for a
+// signal sampled at sampleRate Hz, rounded to the nearest integer.
+func Samples(d time.Duration, sampleRate int) int {
+	return int(math.Floor(d.Seconds()*float64(sampleRate) + 0.5))
+}
+
+// Duration returns the duration of n samples of a signal sampled at sampleRate
+// Hz, or 0 if sampleRate is not strictly positive.
+func Duration(n int, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n) * float64(time.Second) / float64(sampleRate))
+}
+
+// SampleRate returns the sampling rate of the signal processed by the TSM, in
+// Hz, or 0 if it is unknown.
+func (t *TSM) SampleRate() int {
+	return t.s.SampleRate
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type samplesTest struct {
+	duration   time.Duration
+	sampleRate int
+	samples    int
+}
+
+var samplesTests = []samplesTest{
+	{0, 44100, 0},
+	{time.Second, 44100, 44100},
+	{20 * time.Millisecond, 8000, 160},
+	{20 * time.Millisecond, 44100, 882},
+	{20 * time.Millisecond, 192000, 3840},
+	{1024 * time.Second / 44100, 44100, 1024},
+	{time.Millisecond, 44100, 44},
+}
+
+func TestSamples(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range samplesTests {
+		assert.Equal(c.samples, tsm.Samples(c.duration, c.sampleRate), fmt.Sprintf("Samples(%v, %d)", c.duration, c.sampleRate))
+	}
+}
+
+func TestDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Second, tsm.Duration(44100, 44100))
+	assert.Equal(20*time.Millisecond, tsm.Duration(160, 8000))
+	assert.Equal(time.Duration(0), tsm.Duration(160, 0))
+}
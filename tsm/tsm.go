@@ -23,9 +23,23 @@
 package tsm
 
 import (
+	"github.com/Muges/go-tsm/internal/parallel"
 	"github.com/Muges/go-tsm/multichannel"
 	"github.com/Muges/go-tsm/window"
 	"github.com/pkg/errors"
+	"math"
+)
+
+// The errors returned by Settings.Validate (and therefore by New) wrap one of
+// these errors, which can be tested with errors.Is.
+var (
+	ErrInvalidChannels    = errors.New("invalid number of channels")
+	ErrInvalidSampleRate  = errors.New("invalid sample rate")
+	ErrInvalidHop         = errors.New("invalid hop")
+	ErrInvalidFrameLength = errors.New("invalid frame length")
+	ErrInvalidWindow      = errors.New("invalid window")
+	ErrInvalidDelta       = errors.New("invalid delta")
+	ErrNilConverter       = errors.New("nil converter")
 )
 
 // A Converter is an object implementing the conversion of an analysis frame
@@ -40,12 +54,65 @@ type Converter interface {
 	Clear()
 }
 
+// A HopConverter is a Converter which needs to know the number of samples
+// separating each analysis frame from the next one, for example because it
+// processes the input signal continuously instead of frame by frame.
+type HopConverter interface {
+	Converter
+
+	// SetAnalysisHop is called before each call to Convert, with the number
+	// of samples separating the analysis frame from the next one.
+	SetAnalysisHop(analysisHop int)
+}
+
+// A DelayConverter is a Converter whose synthesis frames may be delayed, for
+// example because it needs to buffer some samples before returning them.
+type DelayConverter interface {
+	Converter
+
+	// Delay returns the number of samples by which the output of the
+	// Converter was delayed since the last call to Clear. Flush writes as
+	// many additional samples at the end of the output.
+	Delay() int
+}
+
+// A LatencyConverter is a Converter which delays its output by a fixed number
+// of samples when the speed ratio is 1, in addition to the delay introduced by
+// the frames of the TSM (see TSM.Latency).
+type LatencyConverter interface {
+	Converter
+
+	// Latency returns the number of samples by which the output of the
+	// Converter is delayed for a speed ratio of 1.
+	Latency() int
+}
+
+// A SpeedController is an object which can change the speed of a TSM for each
+// analysis frame, for example depending on the content of the signal.
+type SpeedController interface {
+	// FrameSpeed is called with each analysis frame, before it is windowed
+	// and converted. It returns the speed ratio that should be used to move
+	// from this analysis frame to the next one. If drop is true, the frame
+	// is not written to the output, and the output signal continues directly
+	// with the next frame that is not dropped.
+	FrameSpeed(analysisFrame multichannel.TSMBuffer) (speed float64, drop bool)
+
+	// Clear clears the state of the SpeedController, making it ready to be
+	// used on another signal (or another part of a signal). It is
+	// automatically called by the Flush and Clear methods of the TSM object,
+	// and by SetSpeedController.
+	Clear()
+}
+
 // A Settings is a struct containing the settings for a TSM object. It is used
 // for the creation of a new TSM
 //
-// Channels is the number of channels of the signal that the TSM will process.
-// The other fields are parameters of the TSM algorithm that are explained
-// below.
+// Channels is the number of channels of the signal that the TSM will process,
+// and SampleRate its sampling rate in Hz. SampleRate is optional (it may be 0
+// if it is unknown), and is only used to convert numbers of samples to
+// durations (see the Samples and Duration functions). The other fields are
+// parameters of the TSM algorithm that are explained below, and are all
+// expressed in samples.
 //
 // The basic principle of the TSM is to first decompose the input signal into
 // short overlapping frames, called the analysis frames. The frames have a
@@ -85,6 +152,7 @@ type Converter interface {
 //
 type Settings struct {
 	Channels        int
+	SampleRate      int
 	AnalysisHop     int
 	SynthesisHop    int
 	FrameLength     int
@@ -99,18 +167,98 @@ type Settings struct {
 	Converter Converter
 }
 
+// Validate checks that the settings are valid, and returns an error describing
+// the first invalid field otherwise.
+//
+// The AnalysisHop may take any value: a negative one plays the signal
+// backwards, and 0 freezes it.
+func (s Settings) Validate() error {
+	if s.Channels <= 0 {
+		return errors.Wrapf(ErrInvalidChannels, "the number of channels should be strictly positive, got %d", s.Channels)
+	}
+	if s.SampleRate < 0 {
+		return errors.Wrapf(ErrInvalidSampleRate, "the sample rate should be positive, got %d", s.SampleRate)
+	}
+	if s.SynthesisHop <= 0 {
+		return errors.Wrapf(ErrInvalidHop, "the synthesis hop should be strictly positive, got %d", s.SynthesisHop)
+	}
+	if s.FrameLength < s.SynthesisHop {
+		return errors.Wrapf(ErrInvalidFrameLength, "the frame length (%d) should not be lower than the synthesis hop (%d)", s.FrameLength, s.SynthesisHop)
+	}
+	if s.AnalysisWindow != nil && len(s.AnalysisWindow) != s.FrameLength {
+		return errors.Wrapf(ErrInvalidWindow, "the analysis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.AnalysisWindow))
+	}
+	if s.SynthesisWindow != nil && len(s.SynthesisWindow) != s.FrameLength {
+		return errors.Wrapf(ErrInvalidWindow, "the synthesis window should have the same length as the frames (%d), got %d", s.FrameLength, len(s.SynthesisWindow))
+	}
+	if s.DeltaBefore < 0 || s.DeltaAfter < 0 {
+		return errors.Wrapf(ErrInvalidDelta, "DeltaBefore and DeltaAfter should be positive, got %d and %d", s.DeltaBefore, s.DeltaAfter)
+	}
+	if s.Converter == nil {
+		return ErrNilConverter
+	}
+
+	return nil
+}
+
 // A TSM is an object implementing a Time-Scale Modification procedure.
 //
 type TSM struct {
 	s *Settings
 
-	// When AnalysisHop is larger than FrameLength, some samples from the input
-	// need to be skipped. skipInputSamples tracks how many samples should be
-	// skipped before reading the analysis frame.
-	skipInputSamples  int
+	// The input buffer contains the samples needed to create the analysis
+	// frame (i.e. DeltaBefore + FrameLength + DeltaAfter samples), preceded by
+	// at most history samples which are kept to allow the TSM to play the
+	// signal backwards. position is the offset of the next analysis frame in
+	// the input buffer.
+	//
+	// When the analysis hop is larger than the input buffer, position may be
+	// larger than history, in which case position - history samples from the
+	// input need to be skipped before reading the analysis frame. When playing
+	// the signal backwards, position may be negative, the samples before the
+	// beginning of the input buffer being considered as silent.
+	position int
+	history  int
+
 	normalizeWindow   []float64
 	skipOutputSamples int
 
+	// The analysis hop may not be an integer number of samples (for example
+	// when it is computed from a speed ratio). analysisHop is its exact
+	// value, and hopRemainder is the fractional part that was discarded when
+	// rounding the previous analysis hops, which should be taken into account
+	// for the next ones.
+	analysisHop  float64
+	hopRemainder float64
+	controller   SpeedController
+	effect       Converter
+
+	// When the TSM is held (or when the speed is 0), the input signal is
+	// not read anymore, and the analysis frames are generated by the freezer
+	// from the last one. frozen is true if the freezer contains the spectrum
+	// of the current analysis frame.
+	hold    bool
+	frozen  bool
+	freezer *freezer
+
+	// The samples of the input signal are indexed from 0 (the padding at
+	// the beginning of the input buffer excluded), and so are the output
+	// samples. removed is the number of samples that were removed from the
+	// input buffer, so that the center of the next analysis frame is the
+	// input sample removed + position. lastCenter is the center of the last
+	// analysis frame that was synthesized, and lastOutput the position of its
+	// center in the output. They are used by Flush to stop the output at the
+	// end of the input signal, i.e. at the output sample flushEnd (which is
+	// negative until it is known).
+	removed     int
+	inputCount  int
+	outputCount int
+	frames      int
+	lastCenter  int
+	lastOutput  int
+	flushing    bool
+	flushEnd    int
+
 	inBuffer        multichannel.CBuffer
 	analysisFrame   multichannel.TSMBuffer
 	outBuffer       multichannel.CBuffer
@@ -122,7 +270,13 @@ type TSM struct {
 // New should only be used if you want to implement a new TSM procedure. If you
 // just want to use an existing one, you should create the TSM object from one
 // of the subpackages of this package.
+//
+// It returns an error if the settings are invalid (see Settings.Validate).
 func New(s Settings) (*TSM, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
 	normalizeWindow, err := window.Product(s.AnalysisWindow, s.SynthesisWindow)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create normalizeWindow")
@@ -132,6 +286,7 @@ func New(s Settings) (*TSM, error) {
 		s: &s,
 
 		normalizeWindow: normalizeWindow,
+		analysisHop:     float64(s.AnalysisHop),
 
 		inBuffer:        multichannel.NewCBuffer(s.Channels, s.DeltaBefore+s.FrameLength+s.DeltaAfter),
 		analysisFrame:   multichannel.NewTSMBuffer(s.Channels, s.DeltaBefore+s.FrameLength+s.DeltaAfter),
@@ -148,7 +303,7 @@ func New(s Settings) (*TSM, error) {
 // Flush.
 func (t *TSM) Clear() {
 	// Clear the buffers
-	t.inBuffer.Remove(t.s.FrameLength)
+	t.inBuffer.Remove(t.inBuffer.Len())
 	t.outBuffer.Remove(t.s.FrameLength)
 	t.normalizeBuffer.Remove(t.s.FrameLength)
 
@@ -157,25 +312,100 @@ func (t *TSM) Clear() {
 	// a frame, which should be the peak of the window function.
 	t.inBuffer.SetReadable(t.s.DeltaBefore + t.s.FrameLength/2)
 	t.skipOutputSamples = t.s.FrameLength / 2
+	t.position = 0
+	t.hopRemainder = 0
+	t.frozen = false
+
+	t.removed = 0
+	t.inputCount = 0
+	t.outputCount = 0
+	t.frames = 0
+	t.lastCenter = 0
+	t.lastOutput = 0
+	t.flushing = false
+	t.flushEnd = -1
 
 	t.s.Converter.Clear()
+	if t.effect != nil {
+		t.effect.Clear()
+	}
+	if t.controller != nil {
+		t.controller.Clear()
+	}
 }
 
 // Flush writes the last output samples to the buffer, assuming that no samples
 // will be added to the input, and returns the number of samples that were
-// written.
+// written. The input signal is padded with zeros to process its last samples,
+// and the output stops at the sample corresponding to the end of the input.
 //
 // The return value will always be equal to buffer.Len(), except when there is
-// no more values to be written.
-func (t *TSM) Flush(buffer multichannel.Buffer) int {
-	expectedLength := buffer.Len()
-	length := t.outBuffer.Read(buffer)
+// no more values to be written, in which case the TSM is cleared (see Clear)
+// and can be used on another signal. Flush should therefore be called until
+// it returns less than buffer.Len(). When the signal is played backwards, the
+// output stops at the beginning of the input signal (or at the oldest sample
+// of the history), and when the TSM is held, Flush only writes the samples
+// that were already processed.
+//
+// An error wrapping multichannel.ErrChannelMismatch is returned if the buffer
+// does not have the same number of channels as the TSM.
+func (t *TSM) Flush(buffer multichannel.Buffer) (int, error) {
+	if err := t.checkChannels(buffer); err != nil {
+		return 0, err
+	}
 
-	if expectedLength < buffer.Len() {
-		t.Clear()
+	if !t.flushing {
+		t.flushing = true
+		if t.holding() {
+			t.flushEnd = t.outputCount + t.outBuffer.Len()
+		}
+		t.updateFlushEnd()
 	}
 
-	return length
+	length := 0
+	for length < buffer.Len() {
+		flushEnd := t.flushEnd
+		if c, ok := t.s.Converter.(DelayConverter); ok && flushEnd >= 0 {
+			flushEnd += c.Delay()
+		}
+
+		if flushEnd >= 0 && t.outputCount >= flushEnd {
+			t.Clear()
+			break
+		}
+
+		if t.outBuffer.Len() > 0 {
+			end := buffer.Len()
+			if flushEnd >= 0 && end-length > flushEnd-t.outputCount {
+				end = length + flushEnd - t.outputCount
+			}
+			n := t.outBuffer.Read(buffer.Slice(length, end))
+			t.outputCount += n
+			length += n
+			continue
+		}
+
+		// Pad the input with zeros to process the next frame (no samples are
+		// needed when the signal is played backwards)
+		if !t.reverse() {
+			t.write(multichannel.NewTSMBuffer(t.s.Channels, t.RemainingInputSpace()))
+		}
+		if !t.step() {
+			t.Clear()
+			break
+		}
+	}
+
+	return length, nil
+}
+
+// checkChannels returns an error if the buffer does not have the same number
+// of channels as the TSM.
+func (t *TSM) checkChannels(buffer multichannel.Buffer) error {
+	if buffer.Channels() != t.s.Channels {
+		return errors.Wrapf(multichannel.ErrChannelMismatch, "the buffer should have %d channels, got %d", t.s.Channels, buffer.Channels())
+	}
+	return nil
 }
 
 // Put reads samples from buffer and processes them. It returns the number of samples that were read.
@@ -184,65 +414,248 @@ func (t *TSM) Flush(buffer multichannel.Buffer) int {
 // it is not required. If it is lower, the samples will be buffered but will
 // not be processed. If it is larger, some samples from buffer will not be
 // read.
-func (t *TSM) Put(buffer multichannel.Buffer) int {
-	n := 0
-	if t.skipInputSamples >= buffer.Len() {
-		// All the samples in the buffer have to be skipped
-		n = buffer.Len()
-	} else {
-		n := t.skipInputSamples
-		n += t.inBuffer.Write(buffer.Slice(t.skipInputSamples, buffer.Len()))
-	}
-	t.skipInputSamples -= n
-
-	if t.inBuffer.RemainingSpace() == 0 && t.outBuffer.RemainingSpace() >= t.s.FrameLength {
-		// The input buffer has enough data to process, and there is enough
-		// space in the output buffer to put the result.
-		t.processFrame()
-
-		if t.skipOutputSamples > t.outBuffer.Len() {
-			t.skipOutputSamples -= t.outBuffer.Len()
-			t.outBuffer.Remove(t.outBuffer.Len())
-		} else if t.skipOutputSamples > 0 {
-			t.outBuffer.Remove(t.skipOutputSamples)
-			t.skipOutputSamples = 0
-		}
+//
+// An error wrapping multichannel.ErrChannelMismatch is returned if the buffer
+// does not have the same number of channels as the TSM, in which case no
+// sample is read.
+func (t *TSM) Put(buffer multichannel.Buffer) (int, error) {
+	if err := t.checkChannels(buffer); err != nil {
+		return 0, err
+	}
 
-		t.skipInputSamples = t.s.AnalysisHop - t.s.FrameLength
-		if t.skipInputSamples < 0 {
-			t.skipInputSamples = 0
-		}
+	n := t.write(buffer)
+	t.inputCount += n
+	t.step()
+
+	return n, nil
+}
+
+// write writes samples from buffer to the input buffer, skipping the ones that
+// are not needed to create the next analysis frame, and returns the number of
+// samples that were read.
+func (t *TSM) write(buffer multichannel.Buffer) int {
+	n := t.skipInputSamples()
+	if n > buffer.Len() {
+		n = buffer.Len()
 	}
+	t.position -= n
+	t.removed += n
+	n += t.inBuffer.Write(buffer.Slice(n, buffer.Len()))
 
 	return n
 }
 
+// step processes the next analysis frame if possible, and returns true if it
+// was processed.
+func (t *TSM) step() bool {
+	if !t.frameReady() || t.outBuffer.RemainingSpace() < t.s.FrameLength {
+		return false
+	}
+
+	// The input buffer has enough data to process, and there is enough space
+	// in the output buffer to put the result.
+	t.processFrame()
+
+	if t.skipOutputSamples > t.outBuffer.Len() {
+		t.skipOutputSamples -= t.outBuffer.Len()
+		t.outBuffer.Remove(t.outBuffer.Len())
+	} else if t.skipOutputSamples > 0 {
+		t.outBuffer.Remove(t.skipOutputSamples)
+		t.skipOutputSamples = 0
+	}
+
+	return true
+}
+
 // Receive writes the result of the Time-Scale Modification procedure to
 // buffer, and returns the number of samples that were written per channels.
 //
 // The return value will always be equal to buffer.Len(), except when there is
 // no more values to be written. In this case, you should either call Put to
 // provide more input samples, or Flush if there is no input samples remaining.
-func (t *TSM) Receive(buffer multichannel.Buffer) int {
-	return t.outBuffer.Read(buffer)
+//
+// An error wrapping multichannel.ErrChannelMismatch is returned if the buffer
+// does not have the same number of channels as the TSM.
+func (t *TSM) Receive(buffer multichannel.Buffer) (int, error) {
+	if err := t.checkChannels(buffer); err != nil {
+		return 0, err
+	}
+
+	n := t.outBuffer.Read(buffer)
+	t.outputCount += n
+	return n, nil
+}
+
+// nextAnalysisHop rounds the exact analysis hop hop to an integer number of
+// samples, keeping track of the rounding errors so that they compensate each
+// other over time.
+func (t *TSM) nextAnalysisHop(hop float64) int {
+	hop += t.hopRemainder
+	n := math.Floor(hop)
+	t.hopRemainder = hop - n
+	return int(n)
+}
+
+// inputLength returns the number of samples needed to create an analysis
+// frame.
+func (t *TSM) inputLength() int {
+	return t.s.DeltaBefore + t.s.FrameLength + t.s.DeltaAfter
+}
+
+// reverse returns true if the signal is played backwards.
+func (t *TSM) reverse() bool {
+	return t.analysisHop < 0
+}
+
+// skipInputSamples returns the number of input samples that should be skipped
+// before reading the next analysis frame.
+func (t *TSM) skipInputSamples() int {
+	if t.position-t.history > t.inBuffer.Len() {
+		return t.position - t.history - t.inBuffer.Len()
+	}
+	return 0
+}
+
+// holding returns true if the TSM should sustain the current analysis frame
+// instead of reading the input signal.
+func (t *TSM) holding() bool {
+	return t.hold || (t.analysisHop == 0 && t.controller == nil)
+}
+
+// frameReady returns true if the input buffer contains enough samples to
+// create the next analysis frame. When the signal is played backwards or
+// frozen, the analysis frames are created from the samples that were already
+// added, and no new samples are needed.
+func (t *TSM) frameReady() bool {
+	if t.holding() && t.frozen {
+		return true
+	}
+	return t.reverse() || t.inBuffer.Len() >= t.position+t.inputLength()
+}
+
+// move moves the position of the next analysis frame by offset samples, and
+// discards the input samples that won't be needed anymore.
+func (t *TSM) move(offset int) {
+	t.position += offset
+	if t.position < -t.inputLength() {
+		// The analysis frame only contains silence, there is no need to go
+		// further.
+		t.position = -t.inputLength()
+	}
+
+	if t.position > t.history {
+		n := t.position - t.history
+		if n > t.inBuffer.Len() {
+			n = t.inBuffer.Len()
+		}
+		t.inBuffer.Remove(n)
+		t.position -= n
+		t.removed += n
+	}
+}
+
+// readAnalysisFrame reads the next analysis frame from the input buffer. When
+// the signal is played backwards, the analysis frame is reversed, the
+// DeltaBefore samples preceding the frame in the reversed signal being the
+// ones following it in the input buffer (and vice versa).
+func (t *TSM) readAnalysisFrame() {
+	if !t.reverse() {
+		t.inBuffer.PeekAt(t.analysisFrame, t.position)
+		return
+	}
+
+	t.inBuffer.PeekAt(t.analysisFrame, t.position+t.s.DeltaBefore-t.s.DeltaAfter)
+	t.analysisFrame.Reverse()
 }
 
 // process reads an analysis frame from the input buffer, process it, and writes the result to the output buffer.
 func (t *TSM) processFrame() {
-	// Generate analysis frame, and discard the input samples that won't be
-	// needed anymore
-	t.inBuffer.Peek(t.analysisFrame)
-	t.inBuffer.Remove(t.s.AnalysisHop)
+	var analysisHop int
+	var center int
+	centered := false
+
+	if t.holding() {
+		// Generate an analysis frame from the frozen one. The generated
+		// signal is stationary, and is read at the original speed.
+		if t.freezer == nil {
+			t.freezer = newFreezer(t.s.Channels, t.inputLength())
+		}
+		if !t.frozen {
+			t.readAnalysisFrame()
+			t.freezer.analyze(t.analysisFrame)
+			t.frozen = true
+		}
+
+		analysisHop = t.s.SynthesisHop
+		t.freezer.read(t.analysisFrame, analysisHop)
+	} else {
+		// Generate analysis frame
+		t.readAnalysisFrame()
+
+		hop := t.analysisHop
+		drop := false
+		if t.controller != nil {
+			var speed float64
+			speed, drop = t.controller.FrameSpeed(t.analysisFrame)
+			if t.reverse() {
+				speed = -speed
+			}
+			hop = float64(t.s.SynthesisHop) * speed
+		}
+		analysisHop = t.nextAnalysisHop(hop)
+
+		if t.frozen {
+			// The TSM has just been released, smooth the transition with
+			// the frozen sound.
+			if analysisHop < 0 {
+				t.freezer.release(t.analysisFrame, -analysisHop)
+			} else {
+				t.freezer.release(t.analysisFrame, analysisHop)
+			}
+			t.frozen = false
+		}
+
+		// Move to the next analysis frame, and discard the input samples
+		// that won't be needed anymore. If the analysis hop is larger than
+		// the input buffer, the samples between this frame and the next one
+		// will have to be skipped.
+		center, centered = t.removed+t.position, true
+		t.move(analysisHop)
+		if analysisHop < 0 {
+			analysisHop = -analysisHop
+		}
+
+		if drop {
+			// A dropped frame does not produce any output, so if the end of
+			// the input has been reached, the output stops at the samples
+			// that were already synthesized.
+			t.updateFlushEnd()
+			if t.flushEnd > t.outputCount+t.outBuffer.Len() {
+				t.flushEnd = t.outputCount + t.outBuffer.Len()
+			}
+			return
+		}
+	}
 
 	if t.s.AnalysisWindow != nil {
-		t.analysisFrame.ApplyWindow(t.s.AnalysisWindow)
+		parallel.ForEachChannel(t.s.Channels, t.s.FrameLength, func(k int) {
+			t.analysisFrame[k:k+1].ApplyWindow(t.s.AnalysisWindow)
+		})
 	}
 
 	// Convert the analysis frame into a synthesis frame
+	if c, ok := t.s.Converter.(HopConverter); ok {
+		c.SetAnalysisHop(analysisHop)
+	}
 	synthesisFrame := t.s.Converter.Convert(t.analysisFrame)
+	if t.effect != nil {
+		synthesisFrame = t.effect.Convert(synthesisFrame)
+	}
 
 	if t.s.SynthesisWindow != nil {
-		synthesisFrame.ApplyWindow(t.s.SynthesisWindow)
+		parallel.ForEachChannel(t.s.Channels, t.s.FrameLength, func(k int) {
+			synthesisFrame[k:k+1].ApplyWindow(t.s.SynthesisWindow)
+		})
 	}
 
 	// Overlap and add the synthesis frame in the output buffer
@@ -259,17 +672,162 @@ func (t *TSM) processFrame() {
 	t.outBuffer.Divide(t.normalizeBuffer, t.s.SynthesisHop)
 	t.normalizeBuffer.Remove(t.s.SynthesisHop)
 	t.outBuffer.SetReadable(t.s.SynthesisHop)
+
+	if centered {
+		t.lastCenter = center
+		t.lastOutput = t.frames * t.s.SynthesisHop
+	}
+	t.frames++
+	t.updateFlushEnd()
+}
+
+// updateFlushEnd computes the output sample at which Flush should stop, if the
+// TSM is being flushed and the center of the next analysis frame is past the
+// end of the input signal (or past its oldest sample that was kept, when it is
+// played backwards). It is interpolated between the centers of the last
+// synthesized frame and of the next one.
+func (t *TSM) updateFlushEnd() {
+	if !t.flushing || t.flushEnd >= 0 {
+		return
+	}
+
+	center := t.removed + t.position
+	end := t.inputCount
+	if t.reverse() {
+		end = t.removed - t.s.DeltaBefore - t.s.FrameLength/2
+		if end < 0 {
+			end = 0
+		}
+		if center > end {
+			return
+		}
+	} else if center < end {
+		return
+	}
+
+	output := t.frames * t.s.SynthesisHop
+	if t.frames == 0 || center == t.lastCenter {
+		t.flushEnd = output
+	} else {
+		ratio := float64(end-t.lastCenter) / float64(center-t.lastCenter)
+		t.flushEnd = t.lastOutput + int(math.Floor(ratio*float64(output-t.lastOutput)+0.5))
+		if t.flushEnd < t.outputCount {
+			t.flushEnd = t.outputCount
+		}
+	}
 }
 
 // RemainingInputSpace returns the amount of space available in the input
 // buffer, i.e. the number of samples that can be added to each channel of the
 // buffer.
 func (t *TSM) RemainingInputSpace() int {
-	return t.skipInputSamples + t.inBuffer.RemainingSpace()
+	return t.skipInputSamples() + t.inBuffer.RemainingSpace()
+}
+
+// Latency returns the delay introduced by the TSM for a speed ratio of 1, in
+// samples, i.e. the number of input samples that have to be put before the
+// output sample corresponding to a given input sample can be received.
+//
+// Since the output samples are produced by blocks of SynthesisHop samples, the
+// actual delay of a sample may be up to SynthesisHop - 1 samples larger. The
+// DeltaBefore samples do not contribute to the latency, since the beginning of
+// the input is padded with zeros. If the converter implements
+// LatencyConverter, its latency is added to the one of the frames.
+func (t *TSM) Latency() int {
+	latency := t.s.FrameLength - t.s.SynthesisHop + t.s.DeltaAfter
+	if c, ok := t.s.Converter.(LatencyConverter); ok {
+		latency += c.Latency()
+	}
+	return latency
+}
+
+// Seek moves the position of the next analysis frame by offset samples,
+// without producing any output. A positive offset skips input samples, and a
+// negative one moves back in the history (see SetHistory).
+func (t *TSM) Seek(offset int) {
+	t.move(offset)
 }
 
-// SetSpeed changes the speed ratio.
+// SetHistory sets the number of input samples that are kept after they have
+// been used, so that the signal can be played backwards (by default, no sample
+// is kept). When the signal is played backwards past the oldest sample of the
+// history, the output is silent.
+//
+// For example, to play a whole signal backwards, the history should be at
+// least as long as the signal, and the position of the next analysis frame
+// should be moved to the end of the signal with Seek.
+func (t *TSM) SetHistory(history int) {
+	if history < 0 {
+		history = 0
+	}
+
+	inBuffer := multichannel.NewCBuffer(t.s.Channels, history+t.inputLength())
+
+	// Keep as many samples as possible from the previous input buffer,
+	// starting with the most recent ones.
+	n := t.inBuffer.Len() - inBuffer.RemainingSpace()
+	if n > 0 {
+		t.inBuffer.Remove(n)
+		t.position -= n
+		t.removed += n
+	}
+	samples := multichannel.NewTSMBuffer(t.s.Channels, t.inBuffer.Len())
+	t.inBuffer.Peek(samples)
+	inBuffer.Write(samples)
+
+	t.inBuffer = inBuffer
+	t.history = history
+	t.move(0)
+}
+
+// SetHold freezes the TSM if hold is true: the input signal stops being read,
+// and the sound of the current analysis frame is sustained indefinitely, until
+// SetHold(false) is called. The input samples that are added in the meantime
+// are buffered (as long as there is enough space), but are not processed.
+//
+// The frozen sound is generated by a phase vocoder, which keeps the magnitude
+// spectrum of the analysis frame and advances the phase of each frequency
+// according to its instantaneous frequency. It works best for stationary
+// sounds. When the TSM is released, the frozen sound is cross-faded with the
+// input signal, which may not be in phase with it, so the volume can drop
+// briefly.
+func (t *TSM) SetHold(hold bool) {
+	t.hold = hold
+}
+
+// SetSpeed changes the speed ratio. A negative speed ratio plays the signal
+// backwards, provided that the previous samples were kept (see SetHistory),
+// and a speed ratio of 0 freezes the TSM as SetHold(true) does (unless a
+// SpeedController is set).
+//
+// The analysis hop corresponding to the speed ratio does not need to be an
+// integer: the analysis frames will be separated by a varying number of
+// samples, so that the speed ratio is respected on average.
 func (t *TSM) SetSpeed(speed float64) {
-	t.s.AnalysisHop = int(float64(t.s.SynthesisHop) * speed)
+	t.analysisHop = float64(t.s.SynthesisHop) * speed
+}
 
+// SetSpeedController sets a SpeedController which will choose the speed ratio
+// for each analysis frame, overriding the one set by SetSpeed. If the speed set
+// by SetSpeed is negative, the speed ratios returned by the controller are used
+// to play the signal backwards. It can be removed by calling
+// SetSpeedController(nil). The controller is cleared with the TSM.
+func (t *TSM) SetSpeedController(controller SpeedController) {
+	if controller != nil {
+		controller.Clear()
+	}
+	t.controller = controller
+}
+
+// SetEffect sets a Converter which will be applied to each synthesis frame
+// returned by the Converter of the TSM, before the synthesis window, for
+// example to add spectral effects (see NewSpectralConverter). Several effects
+// can be combined with Chain. The effect should return frames of the same
+// length as the ones it receives, without delaying them. It is cleared with
+// the TSM, and can be removed by calling SetEffect(nil).
+func (t *TSM) SetEffect(effect Converter) {
+	if effect != nil {
+		effect.Clear()
+	}
+	t.effect = effect
 }
@@ -0,0 +1,282 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package tsm_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/sola"
+	"github.com/Muges/go-tsm/solafs"
+	"github.com/Muges/go-tsm/speech"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	"github.com/Muges/go-tsm/wsola"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+type identityConverter struct{}
+
+func (c identityConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	return analysisFrame
+}
+
+func (c identityConverter) Clear() {}
+
+// A sliceConverter returns the frameLength samples following the first
+// deltaBefore samples of the analysis frame.
+type sliceConverter struct {
+	deltaBefore int
+	frameLength int
+}
+
+func (c sliceConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
+	synthesisFrame := make(multichannel.TSMBuffer, len(analysisFrame))
+	for k := range analysisFrame {
+		synthesisFrame[k] = analysisFrame[k][c.deltaBefore : c.deltaBefore+c.frameLength]
+	}
+	return synthesisFrame
+}
+
+func (c sliceConverter) Clear() {}
+
+type validateTest struct {
+	settings tsm.Settings
+	err      error
+}
+
+var validateTests = []validateTest{
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}}, nil},
+	{tsm.Settings{Channels: 1, AnalysisHop: -64, SynthesisHop: 128, FrameLength: 128, Converter: identityConverter{}}, nil},
+	{tsm.Settings{Channels: 1, AnalysisHop: 0, SynthesisHop: 128, FrameLength: 256, DeltaBefore: 10, DeltaAfter: 20, Converter: identityConverter{}}, nil},
+
+	{tsm.Settings{Channels: 0, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, Converter: identityConverter{}}, tsm.ErrInvalidChannels},
+	{tsm.Settings{Channels: -1, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, Converter: identityConverter{}}, tsm.ErrInvalidChannels},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 0, FrameLength: 256, Converter: identityConverter{}}, tsm.ErrInvalidHop},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 64, Converter: identityConverter{}}, tsm.ErrInvalidFrameLength},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, AnalysisWindow: window.Hanning(128), Converter: identityConverter{}}, tsm.ErrInvalidWindow},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, SynthesisWindow: window.Hanning(512), Converter: identityConverter{}}, tsm.ErrInvalidWindow},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, DeltaBefore: -1, Converter: identityConverter{}}, tsm.ErrInvalidDelta},
+	{tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256}, tsm.ErrNilConverter},
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range validateTests {
+		err := c.settings.Validate()
+		_, newErr := tsm.New(c.settings)
+
+		if c.err == nil {
+			assert.NoError(err, fmt.Sprintf("Validate (%d)", i))
+			assert.NoError(newErr, fmt.Sprintf("New (%d)", i))
+		} else {
+			assert.True(errors.Is(err, c.err), fmt.Sprintf("Validate (%d): %v", i, err))
+			assert.True(errors.Is(newErr, c.err), fmt.Sprintf("New (%d): %v", i, newErr))
+		}
+	}
+}
+
+func TestChannelMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := tsm.New(tsm.Settings{Channels: 2, AnalysisHop: 128, SynthesisHop: 128, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}})
+	if !assert.NoError(err) {
+		return
+	}
+
+	buffer := multichannel.NewTSMBuffer(1, 256)
+
+	n, err := s.Put(buffer)
+	assert.Equal(0, n, "Put with the wrong number of channels")
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch), "Put with the wrong number of channels")
+
+	n, err = s.Receive(buffer)
+	assert.Equal(0, n, "Receive with the wrong number of channels")
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch), "Receive with the wrong number of channels")
+
+	n, err = s.Flush(buffer)
+	assert.Equal(0, n, "Flush with the wrong number of channels")
+	assert.True(errors.Is(err, multichannel.ErrChannelMismatch), "Flush with the wrong number of channels")
+
+	_, err = s.Put(multichannel.NewTSMBuffer(2, 256))
+	assert.NoError(err, "Put with the right number of channels")
+}
+
+func TestPutReturnValue(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := tsm.New(tsm.Settings{Channels: 1, AnalysisHop: 64, SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Samples that are buffered without being processed are counted
+	n, err := s.Put(multichannel.NewTSMBuffer(1, 10))
+	assert.NoError(err)
+	assert.Equal(10, n, "Put with a short buffer")
+
+	// Samples that do not fit in the input buffer are not
+	space := s.RemainingInputSpace()
+	n, err = s.Put(multichannel.NewTSMBuffer(1, space+10))
+	assert.NoError(err)
+	assert.Equal(space, n, "Put with a long buffer")
+}
+
+type putTest struct {
+	settings tsm.Settings
+	length   int
+}
+
+var putTests = []putTest{
+	{tsm.Settings{Channels: 1, AnalysisHop: 64, SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}}, 100},
+	{tsm.Settings{Channels: 2, AnalysisHop: 1024, SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}}, 100},
+	{tsm.Settings{Channels: 1, AnalysisHop: 1024, SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}}, 3000},
+}
+
+func TestPut(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range putTests {
+		s, err := tsm.New(c.settings)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		// Put the samples by chunks, and check that Put returns the number
+		// of samples it has read, including the ones that were skipped
+		input := multichannel.NewTSMBuffer(c.settings.Channels, 20*c.settings.AnalysisHop)
+		out := multichannel.NewTSMBuffer(c.settings.Channels, c.settings.SynthesisHop)
+		for position := 0; position < input.Len(); {
+			end := position + c.length
+			if end > input.Len() {
+				end = input.Len()
+			}
+
+			space := s.RemainingInputSpace()
+			n, err := s.Put(input.Slice(position, end))
+			assert.NoError(err)
+			if !assert.True(n > 0, fmt.Sprintf("Put (%d) after %d samples", i, position)) {
+				break
+			}
+			if space >= end-position {
+				assert.Equal(end-position, n, fmt.Sprintf("Put (%d) after %d samples", i, position))
+			}
+			position += n
+
+			s.Receive(out)
+		}
+	}
+}
+
+type latencyTest struct {
+	settings tsm.Settings
+	latency  int
+}
+
+var latencyTests = []latencyTest{
+	{tsm.Settings{Channels: 1, AnalysisHop: 64, SynthesisHop: 64, FrameLength: 256, SynthesisWindow: window.Hanning(256), Converter: identityConverter{}}, 192},
+	{tsm.Settings{Channels: 1, AnalysisHop: 32, SynthesisHop: 32, FrameLength: 128, DeltaBefore: 16, DeltaAfter: 48, SynthesisWindow: window.Hanning(128), Converter: sliceConverter{16, 128}}, 144},
+}
+
+func TestLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	for i, c := range latencyTests {
+		s, err := tsm.New(c.settings)
+		if !assert.NoError(err) {
+			continue
+		}
+		assert.Equal(c.latency, s.Latency(), fmt.Sprintf("Latency (%d)", i))
+
+		// Put the samples one by one, and check the difference between the
+		// number of input samples and the number of output samples
+		in := multichannel.NewTSMBuffer(1, 1)
+		out := multichannel.NewTSMBuffer(1, c.settings.SynthesisHop)
+		var inLength, outLength int
+		for inLength < 10*c.settings.FrameLength {
+			n, _ := s.Put(in)
+			inLength += n
+
+			n, _ = s.Receive(out)
+			outLength += n
+			if n > 0 {
+				assert.Equal(c.latency, inLength-outLength, fmt.Sprintf("Latency (%d) after %d samples", i, inLength))
+			}
+		}
+	}
+}
+
+var methodLatencyTests = []struct {
+	name string
+	new  func(channels int, speed float64) (*tsm.TSM, error)
+	hop  int
+}{
+	{"ola", ola.Default, 128},
+	{"sola", sola.Default, 512},
+	{"solafs", solafs.Default, 512},
+	{"speech", speech.Default, 256},
+	{"wsola", wsola.Default, 512},
+}
+
+func TestMethodLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	const position = 10000
+	input := multichannel.NewTSMBuffer(1, 30000)
+	input[0][position] = 1
+
+	for _, c := range methodLatencyTests {
+		s, err := c.new(1, 1)
+		if !assert.NoError(err, c.name) {
+			continue
+		}
+
+		// Put the samples one by one, and record the number of input samples
+		// that were put when each output sample was received
+		var received []int
+		out := multichannel.NewTSMBuffer(1, 1)
+		for i := 0; i < input.Len(); i++ {
+			s.Put(input.Slice(i, i+1))
+			for {
+				n, _ := s.Receive(out)
+				if n == 0 {
+					break
+				}
+				if math.Abs(out[0][0]) > 0.5 {
+					received = append(received, i+1)
+				}
+			}
+		}
+
+		// The impulse is received between Latency and Latency + SynthesisHop
+		// samples after it was put
+		if !assert.NotEmpty(received, c.name) {
+			continue
+		}
+		delay := received[0] - (position + 1)
+		assert.True(delay >= s.Latency() && delay < s.Latency()+c.hop,
+			fmt.Sprintf("%s: delay %d, latency %d", c.name, delay, s.Latency()))
+	}
+}
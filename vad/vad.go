@@ -0,0 +1,218 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+// Package vad implements a simple voice activity detector, and a
+// tsm.SpeedController using it to speed up or shorten the silences of a
+// speech signal while keeping the speech at a chosen speed.
+package vad
+
+import (
+	"github.com/Muges/go-tsm/multichannel"
+)
+
+// noiseIncrease is the ratio by which the estimation of the energy of the
+// background noise can increase for each frame.
+const noiseIncrease = 1.002
+
+// A Detector is a voice activity detector based on the energy and the
+// zero-crossing rate of the frames of a signal.
+//
+// The Detector keeps an estimation of the energy of the background noise. A
+// frame is considered as speech if its energy is higher than EnergyRatio times
+// the energy of the background noise, or if it is higher than
+// sqrt(EnergyRatio) times the energy of the background noise and its
+// zero-crossing rate is in the range of the ones of unvoiced speech
+// (MinZeroCrossingRate to MaxZeroCrossingRate).
+type Detector struct {
+	// MinEnergy is the mean energy per sample under which a frame is always
+	// considered as silence.
+	MinEnergy float64
+
+	// EnergyRatio is the ratio between the energy of a frame and the energy
+	// of the background noise above which the frame is considered as speech.
+	EnergyRatio float64
+
+	// MinZeroCrossingRate and MaxZeroCrossingRate are the bounds of the
+	// zero-crossing rate (the ratio of consecutive samples that have
+	// different signs) of unvoiced speech.
+	MinZeroCrossingRate float64
+	MaxZeroCrossingRate float64
+
+	// Hangover is the number of frames that are still considered as speech
+	// after the end of a speech segment, to avoid cutting the end of words.
+	Hangover int
+
+	noiseEnergy float64
+	hangover    int
+}
+
+// NewDetector returns a Detector with default parameters.
+func NewDetector() *Detector {
+	return &Detector{
+		MinEnergy:           1e-6,
+		EnergyRatio:         4,
+		MinZeroCrossingRate: 0.1,
+		MaxZeroCrossingRate: 0.45,
+		Hangover:            4,
+	}
+}
+
+// energy returns the mean energy per sample of frame.
+func energy(frame multichannel.TSMBuffer) float64 {
+	if frame.Len() == 0 {
+		return 0
+	}
+
+	var result float64
+	for k := range frame {
+		for _, v := range frame[k] {
+			result += v * v
+		}
+	}
+
+	return result / float64(frame.Channels()*frame.Len())
+}
+
+// zeroCrossingRate returns the ratio of consecutive samples of the average of
+// the channels of frame that have different signs.
+func zeroCrossingRate(frame multichannel.TSMBuffer) float64 {
+	if frame.Len() < 2 {
+		return 0
+	}
+
+	var crossings int
+	var previous float64
+	for i := 0; i < frame.Len(); i++ {
+		var value float64
+		for k := range frame {
+			value += frame[k][i]
+		}
+
+		if i > 0 && (value >= 0) != (previous >= 0) {
+			crossings++
+		}
+		previous = value
+	}
+
+	return float64(crossings) / float64(frame.Len()-1)
+}
+
+// IsSpeech returns true if the frame contains speech.
+//
+// The frames should be given to the Detector in the order in which they
+// appear in the signal, since it keeps an estimation of the energy of the
+// background noise.
+func (d *Detector) IsSpeech(frame multichannel.TSMBuffer) bool {
+	e := energy(frame)
+
+	// Update the estimation of the energy of the background noise : it
+	// follows the energy of the frames when it decreases, and increases
+	// slowly otherwise.
+	if d.noiseEnergy*noiseIncrease < e {
+		d.noiseEnergy *= noiseIncrease
+	} else {
+		d.noiseEnergy = e
+	}
+	if d.noiseEnergy < d.MinEnergy {
+		d.noiseEnergy = d.MinEnergy
+	}
+
+	speech := false
+	if e > d.MinEnergy {
+		if e > d.EnergyRatio*d.noiseEnergy {
+			speech = true
+		} else if e*e > d.EnergyRatio*d.noiseEnergy*d.noiseEnergy {
+			zcr := zeroCrossingRate(frame)
+			speech = zcr >= d.MinZeroCrossingRate && zcr <= d.MaxZeroCrossingRate
+		}
+	}
+
+	if speech {
+		d.hangover = d.Hangover
+		return true
+	}
+	if d.hangover > 0 {
+		d.hangover--
+		return true
+	}
+	return false
+}
+
+// Reset resets the state of the Detector, making it ready to be used on
+// another signal.
+func (d *Detector) Reset() {
+	d.noiseEnergy = 0
+	d.hangover = 0
+}
+
+// A Controller is a tsm.SpeedController which changes the speed of a TSM
+// depending on whether the analysis frames contain speech or not.
+//
+// The speech is played at SpeechSpeed, and the silences at SilenceSpeed. If
+// MaxPause is strictly positive, the silences are also shortened so that they
+// last at most MaxPause samples in the output signal.
+type Controller struct {
+	*Detector
+
+	SpeechSpeed  float64
+	SilenceSpeed float64
+	MaxPause     int
+
+	synthesisHop int
+	pause        int
+}
+
+// NewController returns a new Controller, using a Detector with default
+// parameters. synthesisHop should be the synthesis hop of the TSM which will
+// use it.
+func NewController(synthesisHop int, speechSpeed float64, silenceSpeed float64, maxPause int) *Controller {
+	return &Controller{
+		Detector:     NewDetector(),
+		SpeechSpeed:  speechSpeed,
+		SilenceSpeed: silenceSpeed,
+		MaxPause:     maxPause,
+		synthesisHop: synthesisHop,
+	}
+}
+
+// FrameSpeed returns the speed that should be used for the analysis frame,
+// and drops it if it is part of a silence that already lasted MaxPause
+// samples in the output.
+func (c *Controller) FrameSpeed(analysisFrame multichannel.TSMBuffer) (float64, bool) {
+	if c.IsSpeech(analysisFrame) {
+		c.pause = 0
+		return c.SpeechSpeed, false
+	}
+
+	if c.MaxPause > 0 && c.pause >= c.MaxPause {
+		return c.SilenceSpeed, true
+	}
+
+	c.pause += c.synthesisHop
+	return c.SilenceSpeed, false
+}
+
+// Clear clears the state of the Controller, making it ready to be used on
+// another signal (or another part of a signal). It is automatically called by
+// the Flush and Clear methods of the TSM object.
+func (c *Controller) Clear() {
+	c.Detector.Reset()
+	c.pause = 0
+}
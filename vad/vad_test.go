@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package vad_test
+
+import (
+	"fmt"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/ola"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/vad"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// tone returns a mono buffer containing length samples of a sine wave.
+func tone(amplitude float64, period float64, length int) multichannel.TSMBuffer {
+	buffer := multichannel.NewTSMBuffer(1, length)
+	for i := range buffer[0] {
+		buffer[0][i] = amplitude * math.Sin(2*math.Pi*float64(i)/period)
+	}
+	return buffer
+}
+
+func TestDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	d := vad.NewDetector()
+	d.Hangover = 2
+
+	frames := []struct {
+		frame  multichannel.TSMBuffer
+		speech bool
+	}{
+		{tone(0, 100, 512), false},
+		{tone(0.001, 100, 512), false},
+		{tone(0.5, 100, 512), true},
+		{tone(0.5, 100, 512), true},
+		{tone(0.001, 100, 512), true},
+		{tone(0.001, 100, 512), true},
+		{tone(0.001, 100, 512), false},
+		{tone(0.0025, 5, 512), true},
+		{tone(0.0025, 5, 512), true},
+		{tone(0.0025, 100, 512), true},
+		{tone(0.0025, 100, 512), true},
+		{tone(0.0025, 100, 512), false},
+	}
+
+	for i, f := range frames {
+		assert.Equal(f.speech, d.IsSpeech(f.frame), fmt.Sprintf("IsSpeech (%d)", i))
+	}
+}
+
+func TestController(t *testing.T) {
+	assert := assert.New(t)
+
+	// One second of speech, two seconds of silence, and one second of speech
+	input := multichannel.NewTSMBuffer(1, 4*44100)
+	copy(input[0], tone(0.5, 100, 44100)[0])
+	copy(input[0][3*44100:], tone(0.5, 100, 44100)[0])
+
+	for _, c := range []struct {
+		silenceSpeed float64
+		maxPause     int
+		length       int
+	}{
+		{1, 0, 4 * 44100},
+		{2, 0, 3 * 44100},
+		{2, 22050, 2*44100 + 22050},
+	} {
+		s, err := ola.Default(1, 1)
+		if !assert.NoError(err) {
+			return
+		}
+		s.SetSpeedController(vad.NewController(128, 1, c.silenceSpeed, c.maxPause))
+
+		output := multichannel.NewTSMBuffer(1, 8*44100)
+		var in, out int
+		for in < input.Len() {
+			n := s.RemainingInputSpace()
+			if in+n > input.Len() {
+				n = input.Len() - in
+			}
+			put, _ := s.Put(input.Slice(in, in+n))
+			received, _ := s.Receive(output.Slice(out, output.Len()))
+			in += put
+			out += received
+		}
+		flushed, _ := s.Flush(output.Slice(out, output.Len()))
+		out += flushed
+
+		// Allow a difference of 0.1s, since the frames at the beginning of
+		// the silence are considered as speech by the detector.
+		assert.InDelta(c.length, out, 4410, fmt.Sprintf("Controller(%v, %d)", c.silenceSpeed, c.maxPause))
+	}
+}
+
+func TestControllerClear(t *testing.T) {
+	assert := assert.New(t)
+
+	// One second of silence, one second of speech and one second of silence
+	input := multichannel.NewTSMBuffer(1, 3*44100)
+	copy(input[0][44100:], tone(0.5, 100, 44100)[0])
+
+	s, err := ola.Default(1, 1)
+	if !assert.NoError(err) {
+		return
+	}
+	s.SetSpeedController(vad.NewController(128, 1, 2, 11025))
+
+	// The state of the controller at the end of the first signal should not
+	// change the output of the second one.
+	first, err := tsm.Process(s, input)
+	assert.NoError(err)
+	second, err := tsm.Process(s, input)
+	assert.NoError(err)
+	assert.Equal(first, second)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Muges
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS
+// IN THE SOFTWARE.
+
+package window
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownWindow is returned by ByName when the name of the window is not
+// valid.
+var ErrUnknownWindow = errors.New("unknown window")
+
+// funcs contains the windows without parameters, indexed by name.
+var funcs = map[string]Func{
+	"hanning":         Hanning,
+	"hamming":         Hamming,
+	"blackman":        Blackman,
+	"blackman-harris": BlackmanHarris,
+	"nuttall":         Nuttall,
+	"triangular":      Triangular,
+	"sine":            Sine,
+	"sqrt-hanning":    SqrtHanning,
+}
+
+// parametrizedFuncs contains the windows taking a parameter, indexed by name.
+var parametrizedFuncs = map[string]func(n int, p float64) []float64{
+	"kaiser":   Kaiser,
+	"gaussian": Gaussian,
+	"tukey":    Tukey,
+}
+
+// ByName returns the window function with the given name, which is either the
+// name of a window without parameters (hanning, hamming, blackman,
+// blackman-harris, nuttall, triangular, sine or sqrt-hanning), or the name of
+// a window with a parameter (kaiser, gaussian or tukey) followed by a colon
+// and the value of the parameter:
+//
+//    hanning, _ := window.ByName("hanning")
+//    kaiser, _ := window.ByName("kaiser:8.6")
+//
+func ByName(name string) (Func, error) {
+	if f, ok := funcs[name]; ok {
+		return f, nil
+	}
+
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return nil, ErrUnknownWindow
+	}
+
+	f, ok := parametrizedFuncs[name[:i]]
+	if !ok {
+		return nil, ErrUnknownWindow
+	}
+
+	p, err := strconv.ParseFloat(name[i+1:], 64)
+	if err != nil {
+		return nil, ErrUnknownWindow
+	}
+
+	return func(n int) []float64 {
+		return f(n, p)
+	}, nil
+}
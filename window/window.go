@@ -39,6 +39,154 @@ func Hanning(n int) []float64 {
 	return window
 }
 
+// A Func is a function returning a window of size n.
+type Func func(n int) []float64
+
+// generate returns a periodic window of size n, whose k-th value is f(k/n).
+// f should be a function defined on [0, 1] and symmetric around 1/2.
+func generate(n int, f func(x float64) float64) []float64 {
+	window := make([]float64, n)
+
+	for k := 0; k < n; k++ {
+		window[k] = f(float64(k) / float64(n))
+	}
+
+	return window
+}
+
+// cosineSum returns a periodic generalized cosine window of size n, i.e. a
+// window whose k-th value is a[0] - a[1]*cos(2*pi*k/n) + a[2]*cos(4*pi*k/n) -
+// ...
+func cosineSum(n int, a ...float64) []float64 {
+	return generate(n, func(x float64) float64 {
+		var v float64
+		sign := 1.0
+		for i, c := range a {
+			v += sign * c * math.Cos(2*math.Pi*float64(i)*x)
+			sign = -sign
+		}
+		return v
+	})
+}
+
+// Hamming returns a periodic Hamming window of size n.
+func Hamming(n int) []float64 {
+	return cosineSum(n, 0.54, 0.46)
+}
+
+// Blackman returns a periodic Blackman window of size n.
+func Blackman(n int) []float64 {
+	return cosineSum(n, 0.42, 0.5, 0.08)
+}
+
+// BlackmanHarris returns a periodic 4-term Blackman-Harris window of size n.
+func BlackmanHarris(n int) []float64 {
+	return cosineSum(n, 0.35875, 0.48829, 0.14128, 0.01168)
+}
+
+// Nuttall returns a periodic 4-term Nuttall window of size n (the variant with
+// a continuous first derivative).
+func Nuttall(n int) []float64 {
+	return cosineSum(n, 0.355768, 0.487396, 0.144232, 0.012604)
+}
+
+// besselI0 returns the value of the zeroth-order modified Bessel function of
+// the first kind at x.
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	for k := 1; term > 1e-16*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// Kaiser returns a periodic Kaiser window of size n. beta controls the
+// trade-off between the width of the main lobe and the level of the side
+// lobes (0 gives a rectangular window, and 8.6 a window similar to a Blackman
+// window).
+func Kaiser(n int, beta float64) []float64 {
+	norm := besselI0(beta)
+	return generate(n, func(x float64) float64 {
+		r := 2*x - 1
+		return besselI0(beta*math.Sqrt(1-r*r)) / norm
+	})
+}
+
+// Gaussian returns a periodic Gaussian window of size n. sigma is the standard
+// deviation of the gaussian, relative to half the size of the window (it
+// should usually be lower than 0.5).
+func Gaussian(n int, sigma float64) []float64 {
+	return generate(n, func(x float64) float64 {
+		r := (2*x - 1) / sigma
+		return math.Exp(-0.5 * r * r)
+	})
+}
+
+// Tukey returns a periodic Tukey (or tapered cosine) window of size n. alpha
+// is the fraction of the window inside the cosine tapers: 0 gives a
+// rectangular window, and 1 a Hanning window.
+func Tukey(n int, alpha float64) []float64 {
+	return generate(n, func(x float64) float64 {
+		if x > 0.5 {
+			x = 1 - x
+		}
+		if x >= alpha/2 {
+			return 1
+		}
+		return 0.5 * (1 - math.Cos(2*math.Pi*x/alpha))
+	})
+}
+
+// Triangular returns a periodic triangular (or Bartlett) window of size n.
+func Triangular(n int) []float64 {
+	return generate(n, func(x float64) float64 {
+		return 1 - math.Abs(2*x-1)
+	})
+}
+
+// Sine returns a periodic sine window of size n.
+func Sine(n int) []float64 {
+	return generate(n, func(x float64) float64 {
+		return math.Sin(math.Pi * x)
+	})
+}
+
+// SqrtHanning returns the square root of a periodic Hanning window of size n.
+// It is equal to the sine window, and is usually used as both the analysis
+// and the synthesis window, so that their product is a Hanning window.
+func SqrtHanning(n int) []float64 {
+	window := Hanning(n)
+	for k, v := range window {
+		window[k] = math.Sqrt(v)
+	}
+	return window
+}
+
+// Symmetric returns the symmetric version of size n of the periodic window
+// returned by the function window, which is obtained by computing the periodic
+// window of size n-1 and appending its first value at the end. Periodic
+// windows should be used for the overlap-add of frames, and symmetric windows
+// for filter design.
+//
+//    hamming := window.Symmetric(window.Hamming, 1024)
+//    kaiser := window.Symmetric(func(n int) []float64 {
+//        return window.Kaiser(n, 8.6)
+//    }, 1024)
+//
+func Symmetric(window Func, n int) []float64 {
+	if n <= 0 {
+		return window(0)
+	}
+	if n == 1 {
+		return []float64{1}
+	}
+
+	w := window(n - 1)
+	return append(w, w[0])
+}
+
 // Product returns the product of two windows.
 //
 // If one of the windows is equal to nil, the other will be returned. If both
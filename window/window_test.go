@@ -49,6 +49,104 @@ func TestHanning(t *testing.T) {
 	}
 }
 
+func kaiser5(n int) []float64 {
+	return window.Kaiser(n, 5)
+}
+
+func gaussian04(n int) []float64 {
+	return window.Gaussian(n, 0.4)
+}
+
+func tukey05(n int) []float64 {
+	return window.Tukey(n, 0.5)
+}
+
+type windowTest struct {
+	name   string
+	window window.Func
+
+	periodic  []float64
+	symmetric []float64
+}
+
+var windowTests = []windowTest{
+	{"Hamming", window.Hamming,
+		[]float64{0.08, 0.21473088, 0.54, 0.86526912, 1, 0.86526912, 0.54, 0.21473088},
+		[]float64{0.08, 0.54, 1, 0.54, 0.08}},
+	{"Blackman", window.Blackman,
+		[]float64{0, 0.06644661, 0.34, 0.77355339, 1, 0.77355339, 0.34, 0.06644661},
+		[]float64{0, 0.34, 1, 0.34, 0}},
+	{"BlackmanHarris", window.BlackmanHarris,
+		[]float64{0.00006, 0.02173584, 0.21747, 0.69576416, 1, 0.69576416, 0.21747, 0.02173584},
+		[]float64{0.00006, 0.21747, 1, 0.21747, 0.00006}},
+	{"Nuttall", window.Nuttall,
+		[]float64{0, 0.02003936, 0.211536, 0.69149664, 1, 0.69149664, 0.211536, 0.02003936},
+		[]float64{0, 0.211536, 1, 0.211536, 0}},
+	{"Kaiser", kaiser5,
+		[]float64{0.03671089, 0.23054433, 0.55285177, 0.86801716, 1, 0.86801716, 0.55285177, 0.23054433},
+		[]float64{0.03671089, 0.55285177, 1, 0.55285177, 0.03671089}},
+	{"Gaussian", gaussian04,
+		[]float64{0.04393693, 0.17242162, 0.45783336, 0.82257756, 1, 0.82257756, 0.45783336, 0.17242162},
+		[]float64{0.04393693, 0.45783336, 1, 0.45783336, 0.04393693}},
+	{"Tukey", tukey05,
+		[]float64{0, 0.5, 1, 1, 1, 1, 1, 0.5},
+		[]float64{0, 1, 1, 1, 0}},
+	{"Triangular", window.Triangular,
+		[]float64{0, 0.25, 0.5, 0.75, 1, 0.75, 0.5, 0.25},
+		[]float64{0, 0.5, 1, 0.5, 0}},
+	{"Sine", window.Sine,
+		[]float64{0, 0.38268343, 0.70710678, 0.92387953, 1, 0.92387953, 0.70710678, 0.38268343},
+		[]float64{0, 0.70710678, 1, 0.70710678, 0}},
+	{"SqrtHanning", window.SqrtHanning,
+		[]float64{0, 0.38268343, 0.70710678, 0.92387953, 1, 0.92387953, 0.70710678, 0.38268343},
+		[]float64{0, 0.70710678, 1, 0.70710678, 0}},
+	{"Hanning", window.Hanning,
+		[]float64{0, 0.14644661, 0.5, 0.85355339, 1, 0.85355339, 0.5, 0.146446611},
+		[]float64{0, 0.5, 1, 0.5, 0}},
+}
+
+func TestWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range windowTests {
+		assert.InDeltaSlice(c.periodic, c.window(len(c.periodic)), 0.000001, fmt.Sprintf("%s (periodic)", c.name))
+		assert.InDeltaSlice(c.symmetric, window.Symmetric(c.window, len(c.symmetric)), 0.000001, fmt.Sprintf("%s (symmetric)", c.name))
+
+		assert.Equal([]float64{}, c.window(0), fmt.Sprintf("%s (empty)", c.name))
+		assert.Equal([]float64{1}, window.Symmetric(c.window, 1), fmt.Sprintf("%s (symmetric, size 1)", c.name))
+	}
+}
+
+type byNameTest struct {
+	name   string
+	window window.Func
+}
+
+var byNameTests = []byNameTest{
+	{"hanning", window.Hanning},
+	{"blackman-harris", window.BlackmanHarris},
+	{"sqrt-hanning", window.SqrtHanning},
+	{"kaiser:5", kaiser5},
+	{"gaussian:0.4", gaussian04},
+	{"tukey:0.5", tukey05},
+}
+
+func TestByName(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range byNameTests {
+		f, err := window.ByName(c.name)
+		if assert.NoError(err, c.name) {
+			assert.Equal(c.window(8), f(8), c.name)
+		}
+	}
+
+	for _, name := range []string{"", "unknown", "hanning:1", "kaiser", "kaiser:", "kaiser:x"} {
+		_, err := window.ByName(name)
+		assert.Equal(window.ErrUnknownWindow, err, name)
+	}
+}
+
 type productTest struct {
 	window1 []float64
 	window2 []float64
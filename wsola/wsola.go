@@ -26,11 +26,28 @@
 package wsola
 
 import (
+	"github.com/Muges/go-tsm/internal/fft"
+	"github.com/Muges/go-tsm/internal/parallel"
 	"github.com/Muges/go-tsm/multichannel"
 	"github.com/Muges/go-tsm/tsm"
 	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
+	"math"
 )
 
+func init() {
+	tsm.Register(tsm.Method{
+		Name:        "wsola",
+		Description: "Waveform Similarity-based Overlap-Add, for most signals",
+		Parameters: []tsm.Parameter{
+			tsm.ParamSpeed, tsm.ParamSampleRate, tsm.ParamPreset,
+			tsm.ParamFrameLength, tsm.ParamSynthesisHop, tsm.ParamTolerance,
+			tsm.ParamSynthesisWindow,
+		},
+		New: NewWithOptions,
+	})
+}
+
 // A wsolaConverter implements the conversion of an analysis frame into a
 // synthesis frame for the WSOLA (Waveform Similarity-based Overlap-Add)
 // method.
@@ -39,6 +56,18 @@ type wsolaConverter struct {
 	synthesisHop       int
 	tolerance          int
 	naturalProgression multichannel.TSMBuffer
+
+	// analysisHop is the number of samples separating the current analysis
+	// frame from the next one, previousHop the number of samples separating
+	// it from the previous one, and deltas contains the shift of the previous
+	// synthesis frame of each channel.
+	analysisHop int
+	previousHop int
+	deltas      []int
+
+	// correlators contains a correlator for each channel if they are faster
+	// than maximizeCrossCorrelation, and is nil otherwise.
+	correlators []*correlator
 }
 
 // crossCorrelation returns the cross-correlation of buffer1 and
@@ -74,20 +103,127 @@ func maximizeCrossCorrelation(buffer1 []float64, buffer2 []float64, tolerance in
 	return maxDelta
 }
 
+// A correlator is equivalent to maximizeCrossCorrelation, but computes the
+// cross-correlations with FFTs, which is faster for large frames and
+// tolerances.
+type correlator struct {
+	plan   *fft.RealPlan
+	signal []float64
+	re1    []float64
+	im1    []float64
+	re2    []float64
+	im2    []float64
+}
+
+// fftCorrelationIsFaster returns true if a correlator is faster than
+// maximizeCrossCorrelation for the given frame length and tolerance.
+func fftCorrelationIsFaster(frameLength int, tolerance int) bool {
+	size := fft.NextFastSize(frameLength + 2*tolerance)
+	return 4*float64(size)*math.Log2(float64(size)) < 2*float64(tolerance)*float64(frameLength)
+}
+
+// newCorrelator returns a correlator for buffers of the given length, which is
+// the length of the second buffer passed to maximize.
+func newCorrelator(length int) *correlator {
+	plan := fft.RealPlanFor(fft.NextFastSize(length))
+	return &correlator{
+		plan:   plan,
+		signal: make([]float64, plan.Len()),
+		re1:    make([]float64, plan.Bins()),
+		im1:    make([]float64, plan.Bins()),
+		re2:    make([]float64, plan.Bins()),
+		im2:    make([]float64, plan.Bins()),
+	}
+}
+
+// maximize returns the value delta of the interval [0, 2*tolerance] that
+// maximizes crossCorrelation(buffer1, buffer2, delta), as
+// maximizeCrossCorrelation does.
+func (c *correlator) maximize(buffer1 []float64, buffer2 []float64, tolerance int) int {
+	// The correlations of a silence are exactly 0 without FFTs, but would be
+	// slightly different with them
+	if isSilent(buffer1) || isSilent(buffer2) {
+		return tolerance
+	}
+
+	// The cross-correlations are the inverse transform of the product of
+	// the conjugate of the spectrum of buffer1 and of the spectrum of buffer2.
+	// Since the signal is long enough, they are not affected by the circular
+	// convolution for delta in [0, 2*tolerance].
+	transform := func(buffer []float64, re []float64, im []float64) {
+		copy(c.signal, buffer)
+		for i := len(buffer); i < len(c.signal); i++ {
+			c.signal[i] = 0
+		}
+		c.plan.Forward(c.signal, re, im)
+	}
+	transform(buffer1, c.re1, c.im1)
+	transform(buffer2, c.re2, c.im2)
+	for i := range c.re1 {
+		re := c.re1[i]*c.re2[i] + c.im1[i]*c.im2[i]
+		im := c.re1[i]*c.im2[i] - c.im1[i]*c.re2[i]
+		c.re1[i], c.im1[i] = re, im
+	}
+	c.plan.Inverse(c.re1, c.im1, c.signal)
+
+	var maxDelta int
+	maxValue := c.signal[0]
+	for delta := 1; delta < 2*tolerance; delta++ {
+		if c.signal[delta] > maxValue {
+			maxValue = c.signal[delta]
+			maxDelta = delta
+		}
+	}
+
+	return maxDelta
+}
+
+// isSilent returns true if all the samples of the buffer are equal to 0.
+func isSilent(buffer []float64) bool {
+	for _, v := range buffer {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetAnalysisHop sets the number of samples separating the current analysis
+// frame from the next one.
+func (c *wsolaConverter) SetAnalysisHop(analysisHop int) {
+	c.analysisHop = analysisHop
+}
+
 // Convert creates the synthesis frame by taking the part of the analysis frame
 // which aligns best with the natural progression of the signal.
+//
+// When the previous analysis frame is separated from this one by the synthesis
+// hop (at a speed of 1, e.g. when a transient.Controller processes a
+// transient), the natural progression is exactly at the shift of the previous
+// frame, which is kept: the cross-correlation could otherwise be larger a few
+// periods away, and the transients would be repeated.
 func (c *wsolaConverter) Convert(analysisFrame multichannel.TSMBuffer) multichannel.TSMBuffer {
 	synthesisFrame := make([][]float64, analysisFrame.Channels())
 
-	for k := range analysisFrame {
-		delta := maximizeCrossCorrelation(c.naturalProgression[k], analysisFrame[k], c.tolerance)
+	// The channels are independent, and the search of the best shift is
+	// expensive, so they may be processed concurrently
+	parallel.ForEachChannel(analysisFrame.Channels(), 2*c.tolerance*c.frameLength, func(k int) {
+		delta := c.deltas[k]
+		if c.previousHop != c.synthesisHop {
+			if c.correlators != nil {
+				delta = c.correlators[k].maximize(c.naturalProgression[k], analysisFrame[k], c.tolerance)
+			} else {
+				delta = maximizeCrossCorrelation(c.naturalProgression[k], analysisFrame[k], c.tolerance)
+			}
+			c.deltas[k] = delta
+		}
 
 		copy(c.naturalProgression[k],
 			analysisFrame[k][delta+c.synthesisHop:delta+c.synthesisHop+c.frameLength])
 
 		synthesisFrame[k] = analysisFrame[k][delta : delta+c.frameLength]
-
-	}
+	})
+	c.previousHop = c.analysisHop
 
 	return synthesisFrame
 }
@@ -101,7 +237,9 @@ func (c *wsolaConverter) Clear() {
 		for i := range c.naturalProgression[k] {
 			c.naturalProgression[k][i] = 0
 		}
+		c.deltas[k] = c.tolerance
 	}
+	c.previousHop = 0
 }
 
 // New returns a TSM implementing the WSOLA procedure.
@@ -111,19 +249,33 @@ func (c *wsolaConverter) Clear() {
 // shifted.  Read the documentation of the tsm.Settings type for an explanation
 // of the other arguments.
 func New(channels int, analysisHop int, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
+	return newTSM(channels, 0, analysisHop, synthesisHop, frameLength, tolerance, window.Hanning(frameLength))
+}
+
+// newTSM returns a TSM implementing the WSOLA procedure for a signal sampled at
+// sampleRate Hz.
+func newTSM(channels int, sampleRate int, analysisHop int, synthesisHop int, frameLength int, tolerance int, synthesisWindow []float64) (*tsm.TSM, error) {
 	converter := wsolaConverter{
 		frameLength:        frameLength,
 		synthesisHop:       synthesisHop,
 		tolerance:          tolerance,
 		naturalProgression: multichannel.NewTSMBuffer(channels, frameLength),
+		deltas:             make([]int, channels),
+	}
+	if fftCorrelationIsFaster(frameLength, tolerance) {
+		converter.correlators = make([]*correlator, channels)
+		for k := range converter.correlators {
+			converter.correlators[k] = newCorrelator(frameLength + 2*tolerance)
+		}
 	}
 
 	return tsm.New(tsm.Settings{
 		Channels:        channels,
+		SampleRate:      sampleRate,
 		AnalysisHop:     analysisHop,
 		SynthesisHop:    synthesisHop,
 		FrameLength:     frameLength,
-		SynthesisWindow: window.Hanning(frameLength),
+		SynthesisWindow: synthesisWindow,
 
 		DeltaBefore: tolerance,
 		DeltaAfter:  tolerance + synthesisHop,
@@ -135,12 +287,12 @@ func New(channels int, analysisHop int, synthesisHop int, frameLength int, toler
 // NewWithSpeed returns a TSM implementing the WSOLA procedure, modifying the
 // speed of the input signal by the ratio speed.
 //
-// The arguments speed, synthesisHop, frameLength and tolerance may be strictly
-// negative, in which case they will be replaced by default values.
+// The arguments synthesisHop, frameLength and tolerance may be strictly
+// negative, in which case they will be replaced by default values. A negative
+// speed plays the signal backwards (see the SetHistory method of tsm.TSM).
+//
+// Deprecated: use NewWithOptions, which does not rely on negative values.
 func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int, tolerance int) (*tsm.TSM, error) {
-	if speed < 0 {
-		speed = 1
-	}
 	if frameLength < 0 {
 		frameLength = 1024
 	}
@@ -153,11 +305,58 @@ func NewWithSpeed(channels int, speed float64, synthesisHop int, frameLength int
 
 	analysisHop := int(float64(synthesisHop) * speed)
 
-	return New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	t, err := New(channels, analysisHop, synthesisHop, frameLength, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(speed)
+
+	return t, nil
 }
 
 // Default returns a TSM implementing the WSOLA procedure with sane default
 // parameters.
 func Default(channels int, speed float64) (*tsm.TSM, error) {
-	return NewWithSpeed(channels, speed, -1, -1, -1)
+	return NewWithOptions(channels, tsm.WithSpeed(speed))
+}
+
+// NewWithOptions returns a TSM implementing the WSOLA procedure, configured by
+// the options (see tsm.Config). The default frame length is 1024 samples at
+// 44.1kHz, the default synthesis hop and tolerance are half the frame length,
+// and the default synthesis window is a Hanning window.
+//
+// Since the analysis frames of the WSOLA procedure are longer than the frame
+// length, analysis windows are not supported.
+func NewWithOptions(channels int, options ...tsm.Option) (*tsm.TSM, error) {
+	c := tsm.NewConfig(options...)
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if c.AnalysisWindow != nil {
+		return nil, errors.Wrap(tsm.ErrInvalidWindow, "the WSOLA procedure does not support analysis windows")
+	}
+
+	frameLength := c.Length(c.FrameLength, c.FrameDuration, c.Scale(1024))
+	synthesisHop := c.Length(c.SynthesisHop, c.SynthesisHopDuration, frameLength/2)
+	tolerance := c.Length(c.Tolerance, c.ToleranceDuration, frameLength/2)
+	analysisHop := int(float64(synthesisHop) * c.Speed)
+	_, synthesisWindow := c.Windows(frameLength, nil, window.Hanning)
+
+	t, err := newTSM(channels, c.SampleRate, analysisHop, synthesisHop, frameLength, tolerance, synthesisWindow)
+	if err != nil {
+		return nil, err
+	}
+	t.SetSpeed(c.Speed)
+
+	return t, nil
+}
+
+// Process changes the speed of a whole signal with the WSOLA procedure,
+// configured by the options (see NewWithOptions), and returns the result.
+func Process(input multichannel.Buffer, options ...tsm.Option) (multichannel.TSMBuffer, error) {
+	t, err := NewWithOptions(input.Channels(), options...)
+	if err != nil {
+		return nil, err
+	}
+	return tsm.Process(t, input)
 }
@@ -22,7 +22,15 @@ package wsola
 
 import (
 	"fmt"
+	"github.com/Muges/go-tsm/internal/parallel"
+	"github.com/Muges/go-tsm/multichannel"
+	"github.com/Muges/go-tsm/tsm"
+	"github.com/Muges/go-tsm/window"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"runtime"
 	"testing"
 )
 
@@ -56,3 +64,114 @@ func TestCrossCorrelation(t *testing.T) {
 		assert.Equal(c.out, out, fmt.Sprintf("CrossCorrelation (%d)", i))
 	}
 }
+
+// randomBuffers returns random buffers of length n and n+2*tolerance.
+func randomBuffers(r *rand.Rand, n int, tolerance int) ([]float64, []float64) {
+	buffer1, buffer2 := make([]float64, n), make([]float64, n+2*tolerance)
+	for i := range buffer1 {
+		buffer1[i] = 2*r.Float64() - 1
+	}
+	for i := range buffer2 {
+		buffer2[i] = 2*r.Float64() - 1
+	}
+	return buffer1, buffer2
+}
+
+func TestCorrelator(t *testing.T) {
+	assert := assert.New(t)
+	r := rand.New(rand.NewSource(0))
+
+	for _, c := range []struct {
+		n         int
+		tolerance int
+	}{
+		{1, 1}, {10, 3}, {100, 13}, {1024, 512}, {1000, 250},
+	} {
+		correlator := newCorrelator(c.n + 2*c.tolerance)
+		for i := 0; i < 10; i++ {
+			buffer1, buffer2 := randomBuffers(r, c.n, c.tolerance)
+			assert.Equal(maximizeCrossCorrelation(buffer1, buffer2, c.tolerance), correlator.maximize(buffer1, buffer2, c.tolerance), fmt.Sprintf("maximize (%d, %d)", c.n, c.tolerance))
+		}
+
+		silence := make([]float64, c.n+2*c.tolerance)
+		assert.Equal(c.tolerance, correlator.maximize(silence[:c.n], silence, c.tolerance))
+	}
+
+	assert.True(fftCorrelationIsFaster(1024, 512))
+	assert.False(fftCorrelationIsFaster(1024, 8))
+}
+
+func BenchmarkMaximizeCrossCorrelation(b *testing.B) {
+	buffer1, buffer2 := randomBuffers(rand.New(rand.NewSource(0)), 1024, 512)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		maximizeCrossCorrelation(buffer1, buffer2, 512)
+	}
+}
+
+func BenchmarkCorrelator(b *testing.B) {
+	buffer1, buffer2 := randomBuffers(rand.New(rand.NewSource(0)), 1024, 512)
+	correlator := newCorrelator(len(buffer2))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		correlator.maximize(buffer1, buffer2, 512)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewWithOptions(2, tsm.PresetMusic, tsm.WithSampleRate(48000), tsm.WithSpeed(0.5))
+	assert.NoError(err)
+
+	t2, err := NewWithOptions(2, tsm.PresetLowLatency)
+	if assert.NoError(err) {
+		assert.True(t2.Latency() < 20*44100/1000, "Latency with PresetLowLatency")
+	}
+
+	_, err = NewWithOptions(2, tsm.WithAnalysisWindow(window.Hanning))
+	assert.True(errors.Is(err, tsm.ErrInvalidWindow))
+}
+
+func TestProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	input := multichannel.NewTSMBuffer(2, 44100)
+	for _, speed := range []float64{0.5, 1, 1.5} {
+		output, err := Process(input, tsm.WithSpeed(speed))
+		if assert.NoError(err) {
+			assert.Equal(int(44100/speed), output.Len(), fmt.Sprintf("Process (speed %g)", speed))
+		}
+	}
+}
+
+func TestProcessChannels(t *testing.T) {
+	assert := assert.New(t)
+
+	input := multichannel.NewTSMBuffer(16, 20000)
+	for k := range input {
+		for i := range input[k] {
+			input[k][i] = math.Sin(float64((k+1)*i) / 50)
+		}
+	}
+
+	// The output should not depend on whether the channels are processed
+	// concurrently or not
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	minWork := parallel.MinWork
+	defer func() { parallel.MinWork = minWork }()
+
+	parallel.MinWork = math.MaxInt32
+	expected, err := Process(input, tsm.WithSpeed(0.8))
+	if !assert.NoError(err) {
+		return
+	}
+
+	parallel.MinWork = 0
+	output, err := Process(input, tsm.WithSpeed(0.8))
+	if assert.NoError(err) {
+		assert.Equal(expected, output)
+	}
+}